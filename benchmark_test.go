@@ -0,0 +1,325 @@
+package xmlctx_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/invopop/xmlctx"
+)
+
+// repeatedItemsXML builds an <items> document with n <item> children
+func repeatedItemsXML(n int) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<items count="%d">`, n)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "<item>%d</item>", i)
+	}
+	b.WriteString(`</items>`)
+	return []byte(b.String())
+}
+
+// BenchmarkCapacityHint compares decoding a large list with and without a cap= hint
+func BenchmarkCapacityHint(b *testing.B) {
+	type Hinted struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []int    `xml:"item,cap=count"`
+	}
+	type Unhinted struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []int    `xml:"item"`
+	}
+
+	xmlData := repeatedItemsXML(10000)
+
+	b.Run("with-hint", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v Hinted
+			if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("without-hint", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v Unhinted
+			if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSliceGrowHint compares decoding a 100k-element list with and
+// without WithSliceGrowHint
+func BenchmarkSliceGrowHint(b *testing.B) {
+	type Items struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []int    `xml:"item"`
+	}
+
+	xmlData := repeatedItemsXML(100000)
+
+	for _, bc := range []struct {
+		name string
+		opts []xmlctx.Option
+	}{
+		{"with-hint", []xmlctx.Option{xmlctx.WithSliceGrowHint(100000)}},
+		{"without-hint", nil},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var v Items
+				if err := xmlctx.Unmarshal(xmlData, &v, bc.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// manyTextNodesXML builds a document with n small text elements of mixed types
+func manyTextNodesXML(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`<records>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "<record><name>item-%d</name><count>%d</count><active>true</active></record>", i, i)
+	}
+	b.WriteString(`</records>`)
+	return []byte(b.String())
+}
+
+// BenchmarkManyTextNodes decodes a document dominated by small text nodes
+func BenchmarkManyTextNodes(b *testing.B) {
+	type Record struct {
+		Name   string `xml:"name"`
+		Count  int    `xml:"count"`
+		Active bool   `xml:"active"`
+	}
+	type Records struct {
+		XMLName xml.Name `xml:"records"`
+		Records []Record `xml:"record"`
+	}
+
+	xmlData := manyTextNodesXML(1000)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v Records
+		if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSharedPathPrefixes decodes many path fields sharing a common prefix
+func BenchmarkSharedPathPrefixes(b *testing.B) {
+	type Trade struct {
+		XMLName  xml.Name `xml:"invoice"`
+		ID       string   `xml:"header>trade>agreement>id"`
+		Issued   string   `xml:"header>trade>agreement>issued"`
+		Currency string   `xml:"header>trade>agreement>currency"`
+		Buyer    string   `xml:"header>trade>agreement>buyer"`
+		Seller   string   `xml:"header>trade>agreement>seller"`
+		Total    int      `xml:"header>trade>settlement>total"`
+		Tax      int      `xml:"header>trade>settlement>tax"`
+		Due      string   `xml:"header>trade>settlement>due"`
+	}
+
+	xmlData := []byte(`<invoice><header><trade>
+		<agreement><id>INV-1</id><issued>2024-01-15</issued><currency>EUR</currency><buyer>B</buyer><seller>S</seller></agreement>
+		<settlement><total>100</total><tax>21</tax><due>2024-02-15</due></settlement>
+	</trade></header></invoice>`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v Trade
+		if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// userNamespaces maps the prefixes used by the User fixture to their namespaces
+var userNamespaces = map[string]string{
+	"":    DefaultNS,
+	"ns1": NS1URL,
+	"ns2": NS2URL,
+}
+
+// BenchmarkUnmarshalUser decodes the User fixture, covering attributes, nested
+// structs, namespaces, and slices
+func BenchmarkUnmarshalUser(b *testing.B) {
+	xmlData, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+	if err != nil {
+		b.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var user User
+		if err := xmlctx.Unmarshal(xmlData, &user, xmlctx.WithNamespaces(userNamespaces)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPoolUnmarshal decodes the User fixture concurrently, with pooled
+// decoders and with a new decoder per call
+func BenchmarkPoolUnmarshal(b *testing.B) {
+	xmlData, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+	if err != nil {
+		b.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	pool := xmlctx.NewPool(xmlctx.WithNamespaces(userNamespaces))
+	config := xmlctx.NewConfig(xmlctx.WithNamespaces(userNamespaces))
+	for _, bc := range []struct {
+		name      string
+		unmarshal func([]byte, any) error
+	}{
+		{"pool", pool.Unmarshal},
+		{"config", config.Unmarshal},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var user User
+					if err := bc.unmarshal(xmlData, &user); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// orderLine is an element of the synthetic document built by ordersXML
+type orderLine struct {
+	ID       string `xml:"id,attr"`
+	Currency string `xml:"currency,attr"`
+	Name     string `xml:"product>name"`
+	SKU      string `xml:"product>sku"`
+	Quantity int    `xml:"quantity"`
+}
+
+// orders is the root of the synthetic document built by ordersXML
+type orders struct {
+	XMLName xml.Name    `xml:"orders"`
+	Version string      `xml:"version,attr"`
+	Lines   []orderLine `xml:"line"`
+}
+
+// ordersXML builds an <orders> document with n <line> children
+func ordersXML(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`<orders version="2">`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<line id="L%d" currency="EUR"><product><name>item-%d</name><sku>SKU-%d</sku></product><quantity>%d</quantity></line>`, i, i, i, i)
+	}
+	b.WriteString(`</orders>`)
+	return []byte(b.String())
+}
+
+// BenchmarkUnmarshalLarge decodes a larger synthetic document exercising
+// structs, slices, path fields, and attributes
+func BenchmarkUnmarshalLarge(b *testing.B) {
+	xmlData := ordersXML(1000)
+
+	b.SetBytes(int64(len(xmlData)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v orders
+		if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// allocBudget is the allocation limit for decoding ordersXML(10), about a
+// quarter above the current count; lower it as the decoder improves
+const allocBudget = 650
+
+// TestAllocationBudget guards against allocation regressions in a representative decode
+func TestAllocationBudget(t *testing.T) {
+	xmlData := ordersXML(10)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		var v orders
+		if err := xmlctx.Unmarshal(xmlData, &v); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Logf("allocations per decode: %.0f", allocs)
+	if allocs > allocBudget {
+		t.Errorf("Allocations: got %.0f, want at most %d", allocs, allocBudget)
+	}
+}
+
+// repeatedValuesXML builds a <parties> document with n <party> children that
+// repeat a few long values
+func repeatedValuesXML(n int) []byte {
+	countries := []string{"United Kingdom of Great Britain and Northern Ireland", "Kingdom of the Netherlands"}
+	var b strings.Builder
+	b.WriteString(`<parties>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<party currency="EUR"><country>%s</country></party>`, countries[i%len(countries)])
+	}
+	b.WriteString(`</parties>`)
+	return []byte(b.String())
+}
+
+// BenchmarkStringInterning compares the memory retained by decoded values with
+// and without string interning, reported as retained-B/op
+func BenchmarkStringInterning(b *testing.B) {
+	type Party struct {
+		Currency string `xml:"currency,attr"`
+		Country  string `xml:"country"`
+	}
+	type Parties struct {
+		XMLName xml.Name `xml:"parties"`
+		Parties []Party  `xml:"party"`
+	}
+
+	xmlData := repeatedValuesXML(10000)
+
+	for _, bc := range []struct {
+		name string
+		opts []xmlctx.Option
+	}{
+		{"without-interning", nil},
+		{"with-interning", []xmlctx.Option{xmlctx.WithStringInterning()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var retained int64
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				var v Parties
+				if err := xmlctx.Unmarshal(xmlData, &v, bc.opts...); err != nil {
+					b.Fatal(err)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				// Signed, since the heap can shrink if a collection frees
+				// more than the decode keeps
+				retained += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+				runtime.KeepAlive(v)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package xmlctx
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// cdataOpen is the markup opening a CDATA section
+const cdataOpen = "<![CDATA["
+
+// cdataTracker passes the input through to xml.Decoder and, while enabled,
+// records the offset of the last CDATA section opening. xml.Decoder returns
+// a CDATA section as its own CharData token, indistinguishable from plain
+// text, so a CharData token starting at that offset is known to come from a
+// CDATA section. xml.Decoder doesn't read past the token it returns, so the
+// offsets of earlier sections are never needed again.
+type cdataTracker struct {
+	r       io.ByteReader
+	src     io.Reader
+	offset  int64
+	enabled bool
+	matched int
+	last    int64
+}
+
+// newCDATATracker wraps r, buffering it if it isn't already an io.ByteReader
+func newCDATATracker(r io.Reader) *cdataTracker {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		buffered := bufio.NewReader(r)
+		br, r = buffered, buffered
+	}
+	return &cdataTracker{r: br, src: r, last: -1}
+}
+
+// enable turns tracking on or off. Only structs with both ,chardata and
+// ,cdata fields need it, so other decodes don't pay for scanning the input.
+func (t *cdataTracker) enable(on bool) {
+	if t.enabled != on {
+		t.enabled = on
+		t.matched = 0
+	}
+}
+
+// ReadByte implements io.ByteReader, which xml.Decoder uses to read its input
+func (t *cdataTracker) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err != nil {
+		return b, err
+	}
+	t.offset++
+	if !t.enabled {
+		return b, nil
+	}
+	switch {
+	case b == cdataOpen[t.matched]:
+		t.matched++
+		if t.matched == len(cdataOpen) {
+			t.last = t.offset - int64(len(cdataOpen))
+			t.matched = 0
+		}
+	case b == '<':
+		t.matched = 1
+	default:
+		t.matched = 0
+	}
+	return b, nil
+}
+
+// Read implements io.Reader, passing reads through while tracking is off
+func (t *cdataTracker) Read(p []byte) (int, error) {
+	if !t.enabled {
+		n, err := t.src.Read(p)
+		t.offset += int64(n)
+		return n, err
+	}
+	for i := range p {
+		b, err := t.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = b
+	}
+	return len(p), nil
+}
+
+// isCDATA reports whether text, a CharData token read from decoder starting
+// at offset, is a CDATA section. Tokens replayed from a captured subtree are
+// looked up among those captureSubtree recorded as CDATA.
+func (d *Decoder) isCDATA(decoder *xml.Decoder, offset int64, text xml.CharData) bool {
+	if d.cdata == nil || !d.cdata.enabled {
+		return false
+	}
+	if decoder == d.decoder {
+		return offset == d.cdata.last
+	}
+	return len(text) > 0 && d.replayedCDATA[&text[0]]
+}
+
+// markCDATA records a captured copy of a CDATA section, so that it is still
+// known as CDATA when replayed
+func (d *Decoder) markCDATA(text xml.CharData) {
+	if len(text) == 0 {
+		return
+	}
+	if d.replayedCDATA == nil {
+		d.replayedCDATA = make(map[*byte]bool)
+	}
+	d.replayedCDATA[&text[0]] = true
+}
+
+// cdataTypes caches whether decoding each type may reach a struct with both
+// ,chardata and ,cdata fields
+var cdataTypes sync.Map // map[reflect.Type]bool
+
+// splitsCDATA reports whether decoding a value of type t may reach a struct
+// with both ,chardata and ,cdata fields, which needs CDATA sections tracked
+func splitsCDATA(t reflect.Type) bool {
+	if split, ok := cdataTypes.Load(t); ok {
+		return split.(bool)
+	}
+	split := reachesSplitCDATA(t, make(map[reflect.Type]bool))
+	cdataTypes.Store(t, split)
+	return split
+}
+
+// reachesSplitCDATA implements splitsCDATA, skipping types already visited
+func reachesSplitCDATA(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return reachesSplitCDATA(t.Elem(), visited)
+	case reflect.Struct:
+		var chardata, cdata bool
+		for _, info := range structFields(t) {
+			chardata = chardata || info.tag.has("chardata")
+			cdata = cdata || info.tag.has("cdata")
+			if reachesSplitCDATA(info.typ, visited) {
+				return true
+			}
+		}
+		return chardata && cdata
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package xmlctx
+
+import (
+	"io"
+	"maps"
+	"strings"
+)
+
+// Config holds decoder settings built once from options and shared safely
+// across goroutines, such as the handlers of a server. Each decode gets its
+// own Decoder, so only the settings are shared. Hooks and writers given in
+// options (e.g., WithFieldHook or WithDebugTrace) are called concurrently and
+// must be safe for that.
+type Config struct {
+	template Decoder
+}
+
+// NewConfig applies opts once to create a reusable configuration
+func NewConfig(opts ...Option) *Config {
+	d := NewDecoder(strings.NewReader(""), opts...)
+	// Keep a private copy of the namespace map so later changes by the caller
+	// don't race with decodes
+	d.namespaces = maps.Clone(d.namespaces)
+	return &Config{template: *d}
+}
+
+// NewDecoder creates a decoder reading from r with the configured settings
+func (c *Config) NewDecoder(r io.Reader) *Decoder {
+	d := c.template
+	d.reset(r)
+	return &d
+}
+
+// Unmarshal decodes data into v with the configured settings, like the
+// package-level Unmarshal
+func (c *Config) Unmarshal(data []byte, v any) error {
+	return c.NewDecoder(strings.NewReader(string(data))).Decode(v)
+}
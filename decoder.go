@@ -30,23 +30,211 @@
 package xmlctx
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Decoder wraps xml.Decoder with namespace context awareness
 type Decoder struct {
 	decoder    *xml.Decoder
 	namespaces map[string]string
+	strict     bool
+	// boolNumeric maps "true"/"false" to 1/0 when decoding numeric values
+	boolNumeric bool
+	// trace receives decode decisions when debugging is enabled
+	trace io.Writer
+	// scratch is reused to accumulate element text in the leaf decoders
+	scratch []byte
+	// maxTextLength bounds accumulated text in bytes; zero means unlimited
+	maxTextLength int
+	// lenientNamespaces relaxes namespace matching, see WithLenientNamespaces
+	lenientNamespaces bool
+	// requireRootNamespace checks the root namespace, see WithRequireRootNamespace
+	requireRootNamespace bool
+	// bestEffort keeps partially decoded values on error, see WithBestEffort
+	bestEffort bool
+	// internStrings enables string interning, see WithStringInterning
+	internStrings bool
+	// interned holds the strings decoded so far when interning is enabled
+	interned map[string]string
+	// elemIndex is the position of the slice element about to be decoded,
+	// valid when hasElemIndex is set, for ,index fields
+	elemIndex    int
+	hasElemIndex bool
+	// intBase is the base of the integers of a field tagged base=N, valid
+	// when hasIntBase is set
+	intBase    int
+	hasIntBase bool
+	// schema is checked while decoding, see WithSchema
+	schema *Schema
+	// schemaTags holds the tags of the schema's Elements in sorted order, so
+	// the rules applied to an element matching several don't vary
+	schemaTags []string
+	// violations collects the schema violations found by the current Decode
+	violations []SchemaViolation
+	// timeLocation converts decoded times, see WithTimeLocation
+	timeLocation *time.Location
+	// verifyCounts checks cap= counts against decoded slices, see WithVerifyCounts
+	verifyCounts bool
+	// version and encoding are read from the XML declaration, see Declaration
+	version  string
+	encoding string
+	// cdata records where CDATA sections start in the input, for ,cdata fields
+	cdata *cdataTracker
+	// replayedCDATA holds the captured copies of CDATA sections, by their
+	// first byte, for ,cdata fields decoded from a replay
+	replayedCDATA map[*byte]bool
+	// closedChans holds the channel fields closed by the current Decode, so a
+	// repeated parent element errors instead of sending on or closing them again
+	closedChans map[uintptr]bool
+	// baseNamespace resolves relative namespace URIs, see WithBaseNamespaceURI
+	baseNamespace string
+	// resolvedNamespaces caches the resolution of relative namespace URIs
+	resolvedNamespaces map[string]string
+	// namespacesFromDocument seeds unmapped prefixes from the root element,
+	// see WithNamespacesFromDocument
+	namespacesFromDocument bool
+	// configuredNamespaces holds the namespace map set by options while
+	// namespaces also holds mappings seeded from the document
+	configuredNamespaces map[string]string
+	// documentPrefixes marks the prefixes seeded from the document
+	documentPrefixes map[string]bool
+	// undeclaredPrefixes maps prefixes the document uses without declaring
+	// them to namespace URIs, see WithUndeclaredPrefixURIs
+	undeclaredPrefixes map[string]string
+	// unmatched collects the names of skipped elements, see UnmatchedElements
+	unmatched []xml.Name
+	// strictNumbers rejects padded numbers, see WithStrictNumbers
+	strictNumbers bool
+	// fieldHook is called with each populated field, see WithFieldHook
+	fieldHook func(fieldName string, value reflect.Value) error
+	// textUnmarshalerExcluded lists the types whose UnmarshalText is ignored,
+	// see WithoutTextUnmarshaler
+	textUnmarshalerExcluded map[reflect.Type]bool
+	// disallowDuplicates rejects repeated scalar fields, see WithDisallowDuplicates
+	disallowDuplicates bool
+	// firstWins keeps the first of repeated scalar fields, see WithFirstWins
+	firstWins bool
+	// lowercaseFieldNames matches unnamed fields by their lowercased Go name,
+	// see WithLowercaseFieldNames
+	lowercaseFieldNames bool
+	// noMixedContent rejects text in structs that can't take it, see
+	// WithNoMixedContent
+	noMixedContent bool
+	// skipBadElements skips elements that fail to decode, see
+	// WithSkipBadElements
+	skipBadElements bool
+	// skipped collects the errors of the elements skipped by the current Decode
+	skipped []error
+	// sliceGrowHint is the initial capacity of slices, see WithSliceGrowHint
+	sliceGrowHint int
+	// peeked holds the tokens read by RootName and AtEnd, for Decode to read
+	// again
+	peeked []xml.Token
+	// scopes holds the attributes of the enclosing struct elements that
+	// declare namespaces, innermost last, for ,prefix fields
+	scopes [][]xml.Attr
+	// path holds the start elements being decoded, root first, for
+	// DecodeErrors
+	path []xml.StartElement
+}
+
+// DecodeError is returned when decoding an element fails, giving the path of
+// the element within the document along with the underlying error
+type DecodeError struct {
+	// Path is the chain of element names from the root to the element that
+	// failed (e.g., "user > ns2:metadata > ns2:custom-field"). Prefixes are
+	// those the document most likely used, since xml.Decoder discards them.
+	Path string
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements the error interface
+func (e *DecodeError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedTypeError is returned when a value of a Go type the decoder can't
+// handle is decoded from an element or attribute
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	// Field is the path of struct field names leading to the value (e.g.,
+	// "Settings.Rate"), or empty when decoding into the root value
+	Field string
+}
+
+// Error implements the error interface
+func (e *UnsupportedTypeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("unsupported type: %v", e.Type)
+	}
+	return fmt.Sprintf("unsupported type %v for field %s", e.Type, e.Field)
+}
+
+// withField prefixes the field path of an UnsupportedTypeError in err with
+// the name of the struct field being decoded
+func withField(err error, name string) error {
+	var unsupported *UnsupportedTypeError
+	if errors.As(err, &unsupported) {
+		if unsupported.Field == "" {
+			unsupported.Field = name
+		} else {
+			unsupported.Field = name + "." + unsupported.Field
+		}
+	}
+	return err
 }
 
 // Option is a functional option for configuring the Decoder
 type Option func(*Decoder)
 
+// CharDataCoercer is implemented by structs that need to convert their
+// character data once the element's attributes and children have been decoded,
+// for example to populate a typed field based on a sibling "type" attribute.
+// CoerceCharData receives the trimmed character data of the element.
+type CharDataCoercer interface {
+	CoerceCharData(text string) error
+}
+
+// Finalizer is implemented by structs that derive fields or check invariants
+// once decoded. The decoder calls Finalize after the struct's attributes and
+// children are set, and aborts decoding with any error it returns.
+type Finalizer interface {
+	Finalize() error
+}
+
+// Resettable is implemented by structs that clear their own state. The decoder
+// calls Reset before populating such a struct, so reused (e.g., pooled) values
+// don't keep stale data for fields absent from the new document.
+type Resettable interface {
+	Reset()
+}
+
+// XMLSetter is implemented by types that set themselves from an element's
+// trimmed text or an attribute's value, such as wrappers around atomic
+// counters. It is a lighter-weight hook than xml.Unmarshaler, which takes
+// precedence over it, and takes precedence over encoding.TextUnmarshaler.
+type XMLSetter interface {
+	SetXML(text string) error
+}
+
 // WithNamespaces sets the namespace mappings for the decoder
 // The map keys are prefixes used in Go struct tags (e.g., "ns1", "ns2", "")
 // The map values are the full namespace URIs (e.g., "http://example.com/schema/profile")
@@ -56,17 +244,339 @@ func WithNamespaces(namespaces map[string]string) Option {
 	}
 }
 
+// WithNamespace adds a single prefix to URI mapping to the decoder's namespaces,
+// keeping any mappings set by earlier options. Options are applied in order, so
+// a later WithNamespaces call replaces mappings added here.
+func WithNamespace(prefix, uri string) Option {
+	return WithNamespaceMaps(map[string]string{prefix: uri})
+}
+
+// WithNamespaceMaps merges several namespace maps into the decoder's namespaces,
+// keeping any mappings set by earlier options. When maps define the same prefix,
+// the later map wins. The provided maps are never modified.
+func WithNamespaceMaps(maps ...map[string]string) Option {
+	return func(d *Decoder) {
+		merged := make(map[string]string, len(d.namespaces))
+		for prefix, uri := range d.namespaces {
+			merged[prefix] = uri
+		}
+		for _, m := range maps {
+			for prefix, uri := range m {
+				merged[prefix] = uri
+			}
+		}
+		d.namespaces = merged
+	}
+}
+
+// WithNamespacesFromDocument adds the namespace declarations on each root
+// element to the namespace map, so struct tags can use the document's own
+// prefixes (e.g., xmlns:inv="..." lets "inv:total" match). Mappings set by
+// options take precedence; NamespaceSources reports where each came from.
+func WithNamespacesFromDocument() Option {
+	return func(d *Decoder) {
+		d.namespacesFromDocument = true
+	}
+}
+
+// WithStrict enables strict decoding, where structural mismatches between the
+// document and the struct that are silently ignored by default are reported
+// as errors. For example, a path field like "a>b" errors when <a> holds text
+// instead of a <b> child.
+func WithStrict() Option {
+	return func(d *Decoder) {
+		d.strict = true
+	}
+}
+
+// WithBoolNumericCoercion lets numeric fields accept the boolean literals
+// "true" and "false", decoding them as 1 and 0. It is off by default.
+func WithBoolNumericCoercion() Option {
+	return func(d *Decoder) {
+		d.boolNumeric = true
+	}
+}
+
+// WithDebugTrace writes a line to w for each decode decision: the element being
+// matched, the field it was decoded into (or why it was skipped), and namespace
+// mismatches between elements and struct tags. Tracing costs nothing when unset.
+func WithDebugTrace(w io.Writer) Option {
+	return func(d *Decoder) {
+		d.trace = w
+	}
+}
+
+// WithMaxTextLength limits the text accumulated for a field, such as element
+// text, chardata, ,text content, or inner XML, to n bytes, returning an error
+// when a document exceeds it. It does not bound memory use: xml.Decoder reads
+// each text token whole before the limit is checked, and comments and the
+// subtrees captured for ,text fields and WithSkipBadElements are not limited,
+// so untrusted input should also be limited at the reader (e.g., with
+// io.LimitReader). Zero or negative values disable the limit.
+func WithMaxTextLength(n int) Option {
+	return func(d *Decoder) {
+		d.maxTextLength = n
+	}
+}
+
+// WithLenientNamespaces relaxes namespace matching for documents that qualify
+// names inconsistently. It enables exactly these relaxations:
+//
+//   - Unprefixed element tags (e.g., "name") match elements with no namespace as
+//     well as elements in the configured default namespace. When no default
+//     namespace is configured, they match by local name in any namespace.
+//   - Prefixed element tags (e.g., "ns1:bio") also match unqualified elements
+//     with the same local name, as in documents missing their declarations.
+//   - Prefixed attribute tags (e.g., "ns1:type,attr") also match unqualified
+//     attributes with the same local name.
+//
+// Unprefixed attribute tags already match attributes by local name in any
+// namespace, including the default one, with or without this option. Matching
+// is strict by default.
+func WithLenientNamespaces() Option {
+	return func(d *Decoder) {
+		d.lenientNamespaces = true
+	}
+}
+
+// WithRequireRootNamespace makes decoding fail when the root element's namespace
+// is missing from the namespace map, catching a forgotten or mistyped default
+// namespace that would otherwise decode into an empty struct. When the target
+// struct has a tagged XMLName field, the root must match that tag (e.g., "user"
+// requires the default namespace); otherwise its namespace must be one of the
+// configured URIs, or absent when no default namespace is configured.
+func WithRequireRootNamespace() Option {
+	return func(d *Decoder) {
+		d.requireRootNamespace = true
+	}
+}
+
+// WithBestEffort keeps the work done before an error, such as a syntax error in
+// a truncated feed. Decode and Unmarshal always leave already decoded fields in
+// place; with this option Parse also returns the partially populated value
+// alongside the error instead of the zero value, so callers can inspect what
+// was decoded before the break.
+func WithBestEffort() Option {
+	return func(d *Decoder) {
+		d.bestEffort = true
+	}
+}
+
+// WithStringInterning makes identical decoded string values share storage,
+// reducing memory for documents that repeat values such as country codes or
+// currencies. Element text, chardata, and attribute values are interned in a
+// table that lives for a single Decode call.
+func WithStringInterning() Option {
+	return func(d *Decoder) {
+		d.internStrings = true
+	}
+}
+
+// WithTimeLocation converts decoded time.Time values to loc (e.g., time.UTC)
+// after parsing, normalizing timestamps that arrive with mixed offsets. The
+// instant is unchanged; only its location is.
+func WithTimeLocation(loc *time.Location) Option {
+	return func(d *Decoder) {
+		d.timeLocation = loc
+	}
+}
+
+// WithVerifyCounts checks that slice fields tagged with cap=<attr> (e.g.,
+// xml:"item,cap=count") hold exactly the number of elements declared in that
+// attribute once their parent element ends, returning an error on mismatch.
+// This catches truncated feeds. Elements without the attribute aren't checked.
+func WithVerifyCounts() Option {
+	return func(d *Decoder) {
+		d.verifyCounts = true
+	}
+}
+
+// WithStrictNumbers rejects numeric element and attribute values with leading
+// or trailing whitespace (e.g., <num> 42 </num>), accepting only the bare
+// lexical form. By default surrounding whitespace is trimmed.
+func WithStrictNumbers() Option {
+	return func(d *Decoder) {
+		d.strictNumbers = true
+	}
+}
+
+// WithFieldHook calls hook with the Go name and value of each struct field
+// once it has been populated from an element, attribute, path, or chardata,
+// allowing fields to be logged, redacted, or validated while decoding. Struct
+// fields are passed after their own fields. An error returned by the hook
+// aborts decoding. Slice fields are passed after each element is appended.
+func WithFieldHook(hook func(fieldName string, value reflect.Value) error) Option {
+	return func(d *Decoder) {
+		d.fieldHook = hook
+	}
+}
+
+// WithSliceGrowHint allocates slices decoded from repeated elements with
+// capacity n before their first element is appended, avoiding reallocations
+// when the approximate length of a large list is known in advance. It applies
+// to every such slice without capacity, so it suits documents dominated by one
+// list; a cap=<attr> tag gives per-field hints from the document instead.
+func WithSliceGrowHint(n int) Option {
+	return func(d *Decoder) {
+		d.sliceGrowHint = n
+	}
+}
+
+// WithDisallowDuplicates returns an error when an element matches a field that
+// holds a single value (e.g., a string or struct) for the second time, naming
+// the element and its occurrence. By default later occurrences overwrite
+// earlier ones. Slice, map, and channel fields take any number of elements.
+func WithDisallowDuplicates() Option {
+	return func(d *Decoder) {
+		d.disallowDuplicates = true
+	}
+}
+
+// WithLowercaseFieldNames matches fields whose tags have no name (e.g.,
+// `xml:",omitempty"` or `xml:",attr"`) against their Go field name in lower
+// case, so field Name matches <name>. By default the Go field name is used
+// as-is, like encoding/xml.
+func WithLowercaseFieldNames() Option {
+	return func(d *Decoder) {
+		d.lowercaseFieldNames = true
+	}
+}
+
+// WithSkipBadElements skips a child element that fails to decode into its
+// field, such as <stock>abc</stock> for an int, instead of aborting the whole
+// document. The field keeps the value it had before the element, and the
+// error is recorded for SkippedErrors. Each matched element is captured before
+// it is decoded so it can be skipped cleanly, which costs memory for large
+// elements; CDATA sections within them are still kept apart from text for
+// ,cdata fields. Syntax errors still abort decoding.
+func WithSkipBadElements() Option {
+	return func(d *Decoder) {
+		d.skipBadElements = true
+	}
+}
+
+// WithNoMixedContent returns an error when text other than whitespace appears
+// in an element decoded into a struct without a field to take it (e.g.,
+// ,chardata or ,cdata), to catch malformed documents under strict schemas.
+// By default such text is dropped.
+func WithNoMixedContent() Option {
+	return func(d *Decoder) {
+		d.noMixedContent = true
+	}
+}
+
+// WithFirstWins keeps the first element matching a field that holds a single
+// value (e.g., a string or struct) and skips later occurrences, for schemas
+// that are ambiguous about cardinality. By default later occurrences
+// overwrite earlier ones. WithFirstWins takes precedence over
+// WithDisallowDuplicates, so repeated elements are skipped rather than
+// rejected. Slice, map, and channel fields still take every element.
+func WithFirstWins() Option {
+	return func(d *Decoder) {
+		d.firstWins = true
+	}
+}
+
+// WithoutTextUnmarshaler decodes values of the given types by their kind (e.g.,
+// as a plain string), ignoring their UnmarshalText method, for types whose
+// text form is meant for other encodings such as JSON. Types may be given as
+// values or pointers, e.g. reflect.TypeFor[Status]().
+func WithoutTextUnmarshaler(types ...reflect.Type) Option {
+	return func(d *Decoder) {
+		if d.textUnmarshalerExcluded == nil {
+			d.textUnmarshalerExcluded = make(map[reflect.Type]bool)
+		}
+		for _, t := range types {
+			if t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			d.textUnmarshalerExcluded[t] = true
+		}
+	}
+}
+
+// WithHTMLEntities accepts the named character entities of HTML 4 (e.g.,
+// &nbsp;, &copy;, &eacute;), which XML doesn't predefine, decoding each to its
+// Unicode character. This helps with feeds scraped from HTML, which would
+// otherwise fail with an invalid entity error.
+func WithHTMLEntities() Option {
+	return func(d *Decoder) {
+		d.decoder.Entity = xml.HTMLEntity
+	}
+}
+
+// WithBaseNamespaceURI resolves relative namespace URIs in the document (e.g.,
+// xmlns="orders/v2") against base, an absolute URI, before element and
+// attribute namespaces are matched against the namespace map. With a base of
+// "http://example.com/", "orders/v2" matches "http://example.com/orders/v2".
+func WithBaseNamespaceURI(base string) Option {
+	return func(d *Decoder) {
+		d.baseNamespace = base
+	}
+}
+
+// WithUndeclaredPrefixURIs maps prefixes that the document uses without ever
+// declaring them (e.g., <prf:bio> with no xmlns:prf) to the namespace URIs
+// they were meant to have, to rescue slightly broken feeds. xml.Decoder
+// leaves such a prefix in place of the element's namespace URI, so elements
+// and attributes whose namespace is one of the prefixes are matched as if in
+// the mapped namespace. Prefixes the document declares are unaffected.
+func WithUndeclaredPrefixURIs(prefixes map[string]string) Option {
+	return func(d *Decoder) {
+		d.undeclaredPrefixes = prefixes
+	}
+}
+
 // NewDecoder creates a new namespace-aware decoder
 func NewDecoder(r io.Reader, opts ...Option) *Decoder {
-	d := &Decoder{
-		decoder: xml.NewDecoder(r),
-	}
+	d := &Decoder{}
+	d.reset(r)
 	for _, opt := range opts {
 		opt(d)
 	}
 	return d
 }
 
+// Reset discards the decoder's state and makes it read from r, keeping the
+// settings made by options, as if created again by NewDecoder. Namespaces
+// seeded by WithNamespacesFromDocument are dropped, and buffers are kept for
+// reuse, so hot paths can reuse one decoder per goroutine (or use a Pool).
+func (d *Decoder) Reset(r io.Reader) {
+	scratch := d.scratch[:0]
+	d.reset(r)
+	d.scratch = scratch
+}
+
+// reset prepares the decoder to read from r, clearing the state of earlier
+// decodes while keeping the settings made by options
+func (d *Decoder) reset(r io.Reader) {
+	var entity map[string]string
+	if d.decoder != nil {
+		entity = d.decoder.Entity
+	}
+	d.cdata = newCDATATracker(r)
+	d.decoder = xml.NewDecoder(d.cdata)
+	d.decoder.Entity = entity
+	d.scratch = nil
+	d.interned = nil
+	d.elemIndex, d.hasElemIndex = 0, false
+	d.intBase, d.hasIntBase = 0, false
+	d.violations = nil
+	d.version, d.encoding = "", ""
+	d.resolvedNamespaces = nil
+	d.unmatched = nil
+	d.skipped = nil
+	d.peeked = nil
+	d.scopes = nil
+	d.path = nil
+	d.replayedCDATA = nil
+	d.closedChans = nil
+	if d.documentPrefixes != nil {
+		d.namespaces = d.configuredNamespaces
+		d.documentPrefixes = nil
+	}
+}
+
 // Unmarshal decodes XML with namespace context awareness
 func Unmarshal(data []byte, v any, opts ...Option) error {
 	r := strings.NewReader(string(data))
@@ -74,16 +584,73 @@ func Unmarshal(data []byte, v any, opts ...Option) error {
 	return dec.Decode(v)
 }
 
+// UnmarshalPrefix decodes the first root element in data, like Unmarshal, and
+// returns the bytes following it. This allows framed parsing of protocols that
+// concatenate a document with trailing data or further documents.
+func UnmarshalPrefix(data []byte, v any, opts ...Option) (rest []byte, err error) {
+	dec := NewDecoder(bytes.NewReader(data), opts...)
+	if err := dec.Decode(v); err != nil {
+		return nil, err
+	}
+	return data[dec.decoder.InputOffset():], nil
+}
+
+// Parse decodes XML with namespace context awareness into a new value of type T
+// and returns it. T may be a struct, scalar, slice, or pointer type; pointer
+// types are allocated as needed. Empty input yields the zero value of T. On
+// error the zero value is returned, unless WithBestEffort is set.
+func Parse[T any](data []byte, opts ...Option) (T, error) {
+	var v T
+	dec := NewDecoder(bytes.NewReader(data), opts...)
+	if err := dec.Decode(&v); err != nil {
+		if dec.bestEffort {
+			return v, err
+		}
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
 // Decode decodes the XML into the provided value
 func (d *Decoder) Decode(v any) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
 		return fmt.Errorf("decode target must be a non-nil pointer")
 	}
+	return d.DecodeValue(rv.Elem())
+}
+
+// DecodeValue decodes the XML into rv, which must be addressable and
+// settable, such as a value reached through a pointer with Elem. It is a
+// lower-level form of Decode for callers that already hold a reflect.Value,
+// such as generated code and framework integrations.
+func (d *Decoder) DecodeValue(rv reflect.Value) error {
+	if !rv.IsValid() || !rv.CanSet() {
+		return fmt.Errorf("decode target must be an addressable, settable value")
+	}
+
+	if d.baseNamespace != "" {
+		if base, err := url.Parse(d.baseNamespace); err != nil || !base.IsAbs() {
+			return fmt.Errorf("base namespace URI %q is not an absolute URI", d.baseNamespace)
+		}
+	}
 
-	// Read tokens until we find the root element
+	if d.internStrings {
+		d.interned = make(map[string]string)
+		defer func() { d.interned = nil }()
+	}
+
+	// Track CDATA sections only for values that keep them apart from text
+	d.cdata.enable(splitsCDATA(rv.Type()))
+	d.replayedCDATA = nil
+	d.closedChans = nil
+
+	// Read tokens until we find the root element. xml.Decoder advances on
+	// every token or returns an error, so truncated or malformed input ends
+	// the loop.
 	for {
-		tok, err := d.decoder.Token()
+		tok, err := d.rootToken()
 		if err == io.EOF {
 			return nil
 		}
@@ -91,468 +658,1683 @@ func (d *Decoder) Decode(v any) error {
 			return err
 		}
 
-		if start, ok := tok.(xml.StartElement); ok {
-			return d.decodeElement(d.decoder, rv.Elem(), start)
+		if inst, ok := tok.(xml.ProcInst); ok && inst.Target == "xml" {
+			d.version = procInstParam(string(inst.Inst), "version")
+			d.encoding = procInstParam(string(inst.Inst), "encoding")
 		}
-	}
-}
-
-// decodeElement decodes an XML element into a reflect.Value
-func (d *Decoder) decodeElement(decoder *xml.Decoder, v reflect.Value, start xml.StartElement) error {
-	// xml.Decoder has already resolved start.Name.Space to the full URI
-	// start.Name.Local contains the local name without prefix
 
-	// Check if the type implements xml.Unmarshaler
-	if v.CanAddr() {
-		pv := v.Addr()
-		if pv.CanInterface() {
-			if u, ok := pv.Interface().(xml.Unmarshaler); ok {
-				// Use custom unmarshaler
-				return u.UnmarshalXML(decoder, start)
+		if start, ok := tok.(xml.StartElement); ok {
+			if d.namespacesFromDocument {
+				d.seedNamespaces(start.Attr)
 			}
-		}
-	}
-
-	// Check if the type implements encoding.TextUnmarshaler (for simple values)
-	if v.CanAddr() {
-		pv := v.Addr()
-		if pv.CanInterface() {
-			if u, ok := pv.Interface().(interface{ UnmarshalText([]byte) error }); ok {
-				// Read the element content as text
-				var text strings.Builder
-				for {
-					tok, err := decoder.Token()
-					if err == io.EOF {
-						break
-					}
-					if err != nil {
-						return err
-					}
-					switch t := tok.(type) {
-					case xml.CharData:
-						text.Write(t)
-					case xml.EndElement:
-						return u.UnmarshalText([]byte(strings.TrimSpace(text.String())))
-					case xml.StartElement:
-						// Skip nested elements
-						if err := decoder.Skip(); err != nil {
-							return err
-						}
-					}
+			if d.requireRootNamespace {
+				if err := d.checkRootNamespace(rv, start); err != nil {
+					return err
 				}
-				return nil
 			}
+			d.violations = nil
+			d.unmatched = nil
+			d.skipped = nil
+			d.checkSchemaNamespace(xml.Name{}, start.Name)
+			// A slice target treats the root as a container for its elements
+			if d.isContainerSlice(rv) {
+				d.enterElement(start)
+				err = d.leaveElement(d.decodeChildrenIntoSlice(d.decoder, rv))
+			} else {
+				err = d.decodeElement(d.decoder, rv, start)
+			}
+			if err == nil && len(d.violations) > 0 {
+				err = &SchemaError{Violations: d.violations}
+			}
+			return err
 		}
 	}
+}
 
-	switch v.Kind() {
-	case reflect.Pointer:
-		// Initialize pointer if nil
-		if v.IsNil() {
-			v.Set(reflect.New(v.Type().Elem()))
+// RootName returns the name of the next root element without consuming it, so
+// callers can choose the value to decode into. This allows one endpoint to
+// accept several document types (e.g., <invoice> or <creditNote>):
+//
+//	name, err := dec.RootName()
+//	if err != nil {
+//	    return err
+//	}
+//	switch name.Local {
+//	case "invoice":
+//	    err = dec.Decode(&invoice)
+//	case "creditNote":
+//	    err = dec.Decode(&creditNote)
+//	}
+//
+// Structs that accept several root names can record the one decoded in their
+// XMLName field. RootName returns io.EOF if the input has no further element.
+func (d *Decoder) RootName() (xml.Name, error) {
+	if n := len(d.peeked); n > 0 {
+		if start, ok := d.peeked[n-1].(xml.StartElement); ok {
+			return start.Name, nil
 		}
-		// Decode into the element the pointer points to
-		return d.decodeElement(decoder, v.Elem(), start)
-	case reflect.Struct:
-		return d.decodeStruct(decoder, v, start)
-	case reflect.String:
-		return d.decodeString(decoder, v)
-	case reflect.Bool:
-		return d.decodeBool(decoder, v)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return d.decodeInt(decoder, v)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return d.decodeUint(decoder, v)
-	case reflect.Slice:
-		// For slices, create a new element and decode into it
-		elemType := v.Type().Elem()
-		elem := reflect.New(elemType).Elem()
-		if err := d.decodeElement(decoder, elem, start); err != nil {
-			return err
+	}
+	for {
+		tok, err := d.decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		// Token reuses its buffers, so keep copies for Decode
+		d.peeked = append(d.peeked, xml.CopyToken(tok))
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
 		}
-		v.Set(reflect.Append(v, elem))
-		return nil
-	default:
-		return fmt.Errorf("unsupported type: %v", v.Kind())
 	}
 }
 
+// DecodeRootAttrs decodes only the root element's name and attributes into
+// the XMLName and attribute fields of v, a pointer to a struct, without
+// reading the rest of the document. This makes routing decisions based on
+// header attributes cheap for large documents. The decoder is left inside the
+// root element, so the document can't be decoded by it afterwards.
+func (d *Decoder) DecodeRootAttrs(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer")
+	}
+	target := rv.Elem()
+	for target.Kind() == reflect.Pointer {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+	if target.Kind() != reflect.Struct {
+		return &UnsupportedTypeError{Type: target.Type()}
+	}
 
-// pathFieldInfo holds information about a struct field with path syntax
-type pathFieldInfo struct {
-	field reflect.Value
-	tag   string
+	for {
+		tok, err := d.rootToken()
+		if err != nil {
+			return err
+		}
+		if inst, ok := tok.(xml.ProcInst); ok && inst.Target == "xml" {
+			d.version = procInstParam(string(inst.Inst), "version")
+			d.encoding = procInstParam(string(inst.Inst), "encoding")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if err := d.setXMLName(target, start); err != nil {
+				return err
+			}
+			return d.decodeAttributes(target, start.Attr)
+		}
+	}
 }
 
-// findAllPathFieldsWithPrefix finds all struct fields whose path starts with the given element
-func (d *Decoder) findAllPathFieldsWithPrefix(v reflect.Value, start xml.StartElement) []pathFieldInfo {
-	t := v.Type()
-	elemNS := start.Name.Space
-	elemLocal := start.Name.Local
+// AtEnd reports whether the input holds nothing more after the last Decode
+// than whitespace, comments, and processing instructions, e.g. to check that
+// an input is a single document. Tokens are peeked rather than consumed, so a
+// following document can still be decoded when AtEnd returns false.
+func (d *Decoder) AtEnd() (bool, error) {
+	for _, tok := range d.peeked {
+		if !isTrailingToken(tok) {
+			return false, nil
+		}
+	}
+	for {
+		tok, err := d.decoder.Token()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		d.peeked = append(d.peeked, xml.CopyToken(tok))
+		if !isTrailingToken(tok) {
+			return false, nil
+		}
+	}
+}
+
+// isTrailingToken reports whether tok may follow a document's root element
+// without being further content
+func isTrailingToken(tok xml.Token) bool {
+	switch t := tok.(type) {
+	case xml.CharData:
+		return len(bytes.TrimSpace(t)) == 0
+	case xml.Comment, xml.ProcInst:
+		return true
+	}
+	return false
+}
+
+// rootToken returns the next token before the root element, taking those
+// read by RootName first
+func (d *Decoder) rootToken() (xml.Token, error) {
+	if len(d.peeked) > 0 {
+		tok := d.peeked[0]
+		d.peeked = d.peeked[1:]
+		return tok, nil
+	}
+	return d.decoder.Token()
+}
+
+// Declaration returns the version and encoding from the document's XML
+// declaration (e.g., <?xml version="1.0" encoding="UTF-8"?>) once Decode has
+// read past it. Values missing from the declaration, or from the document,
+// are returned empty.
+func (d *Decoder) Declaration() (version, encoding string) {
+	return d.version, d.encoding
+}
+
+// UnmatchedElements returns the names of the elements the last Decode skipped
+// because they matched no field and no ,any field took them, each name listed
+// once in order of first appearance. It helps discover the parts of a new
+// feed that a struct ignores.
+func (d *Decoder) UnmatchedElements() []xml.Name {
+	return d.unmatched
+}
+
+// Raw returns the underlying xml.Decoder, as an escape hatch for advanced
+// uses such as calling RawToken or setting CharsetReader after creation.
+// Tokens read through it bypass namespace-aware matching and are not seen by
+// Decode, which resumes from wherever the xml.Decoder was left; an XML
+// declaration read this way is not reported by Declaration, and tokens
+// already peeked by RootName or AtEnd are not returned again.
+func (d *Decoder) Raw() *xml.Decoder {
+	return d.decoder
+}
+
+// SkippedErrors returns the errors of the elements the last Decode skipped
+// under WithSkipBadElements, in document order, each naming its element.
+func (d *Decoder) SkippedErrors() []error {
+	return d.skipped
+}
+
+// recordUnmatched adds name to the unmatched elements if not already present
+func (d *Decoder) recordUnmatched(name xml.Name) {
+	if !slices.Contains(d.unmatched, name) {
+		d.unmatched = append(d.unmatched, name)
+	}
+}
+
+// procInstParam returns the value of a pseudo-attribute such as version="1.0"
+// in the content of a processing instruction
+func procInstParam(inst, param string) string {
+	for {
+		i := strings.Index(inst, param)
+		if i < 0 {
+			return ""
+		}
+		rest := strings.TrimLeft(inst[i+len(param):], " \t\r\n")
+		// Require a whole name, e.g. not "version" inside "subversion"
+		if (i > 0 && !unicode.IsSpace(rune(inst[i-1]))) || !strings.HasPrefix(rest, "=") {
+			inst = inst[i+len(param):]
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return ""
+		}
+		value, _, ok := strings.Cut(rest[1:], rest[:1])
+		if !ok {
+			return ""
+		}
+		return value
+	}
+}
+
+// checkRootNamespace reports an error if the root element's namespace is not
+// the one expected for it. The expectation comes from the XMLName tag of the
+// target struct when present (e.g., "user" expects the default namespace), and
+// otherwise is any configured namespace URI.
+func (d *Decoder) checkRootNamespace(v reflect.Value, start xml.StartElement) error {
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		if field, ok := t.FieldByName("XMLName"); ok {
+			if name, _, _ := strings.Cut(field.Tag.Get("xml"), ","); name != "" {
+				if !d.matchesField(name, start.Name.Local, start.Name.Space) {
+					return fmt.Errorf("root element %s: namespace %q does not match tag %q", start.Name.Local, start.Name.Space, name)
+				}
+				return nil
+			}
+		}
+	}
+
+	if start.Name.Space == "" {
+		if _, ok := d.namespaces[""]; !ok {
+			return nil
+		}
+	}
+	for _, uri := range d.namespaces {
+		if uri == start.Name.Space {
+			return nil
+		}
+	}
+	return fmt.Errorf("root element %s: namespace %q is not in the namespace map", start.Name.Local, start.Name.Space)
+}
+
+// SetAttrValue decodes the attribute value s into v, which must be a non-nil
+// pointer, using the same parsing rules the decoder applies to attribute fields.
+// It lets custom xml.UnmarshalerAttr implementations reuse the decoder's coercion.
+func (d *Decoder) SetAttrValue(v any, s string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("attribute target must be a non-nil pointer")
+	}
+	return d.setFieldValue(rv.Elem(), s)
+}
+
+// isContainerSlice reports whether v is a slice that collects repeated elements
+// (as opposed to a []byte holding text content, or a slice-based type that
+// unmarshals itself, such as a decimal stored as digits)
+func (d *Decoder) isContainerSlice(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !d.unmarshalsItself(v.Type())
+}
+
+// Interfaces of types that decode themselves
+var (
+	textUnmarshalerType = reflect.TypeFor[interface{ UnmarshalText([]byte) error }]()
+	xmlUnmarshalerType  = reflect.TypeFor[xml.Unmarshaler]()
+	xmlSetterType       = reflect.TypeFor[XMLSetter]()
+)
+
+// unmarshalsItself reports whether pointers to t implement xml.Unmarshaler,
+// XMLSetter, or encoding.TextUnmarshaler, so values of t must be decoded
+// through them
+func (d *Decoder) unmarshalsItself(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	return (d.usesTextUnmarshaler(t) && pt.Implements(textUnmarshalerType)) || pt.Implements(xmlUnmarshalerType) || pt.Implements(xmlSetterType)
+}
+
+// usesTextUnmarshaler reports whether values of t are decoded through their
+// UnmarshalText method, if any, rather than excluded by WithoutTextUnmarshaler
+func (d *Decoder) usesTextUnmarshaler(t reflect.Type) bool {
+	return !d.textUnmarshalerExcluded[t]
+}
+
+// decodeChildrenIntoSlice appends each child element of the current element to the slice
+func (d *Decoder) decodeChildrenIntoSlice(decoder *xml.Decoder, v reflect.Value) error {
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if err := d.decodeElement(decoder, v, t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			// End of the container element
+			return nil
+		}
+	}
+	return nil
+}
+
+// decodeElement decodes an XML element into a reflect.Value, wrapping any
+// error in a DecodeError giving the element's path
+func (d *Decoder) decodeElement(decoder *xml.Decoder, v reflect.Value, start xml.StartElement) error {
+	d.enterElement(start)
+	return d.leaveElement(d.decodeValue(decoder, v, start))
+}
+
+// enterElement adds start to the path of the elements being decoded
+func (d *Decoder) enterElement(start xml.StartElement) {
+	d.path = append(d.path, start)
+}
+
+// leaveElement removes the last element entered from the path, first wrapping
+// err, if any, in a DecodeError giving the path to it. Errors already carrying
+// the path of an element within it are returned as they are.
+func (d *Decoder) leaveElement(err error) error {
+	if err != nil {
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			err = &DecodeError{Path: d.formatPath(), Err: err}
+		}
+	}
+	d.path = d.path[:len(d.path)-1]
+	return err
+}
+
+// decodeValue decodes an XML element into a reflect.Value
+func (d *Decoder) decodeValue(decoder *xml.Decoder, v reflect.Value, start xml.StartElement) error {
+	// xml.Decoder has already resolved start.Name.Space to the full URI
+	// start.Name.Local contains the local name without prefix
+
+	// Check if the type implements xml.Unmarshaler
+	if v.CanAddr() {
+		pv := v.Addr()
+		if pv.CanInterface() {
+			if u, ok := pv.Interface().(xml.Unmarshaler); ok {
+				// Use custom unmarshaler
+				return u.UnmarshalXML(decoder, start)
+			}
+		}
+	}
+
+	// Check if the type implements XMLSetter
+	if v.CanAddr() {
+		pv := v.Addr()
+		if pv.CanInterface() {
+			if setter, ok := pv.Interface().(XMLSetter); ok {
+				text, err := d.readText(decoder)
+				if err != nil {
+					return err
+				}
+				return setter.SetXML(string(bytes.TrimSpace(text)))
+			}
+		}
+	}
+
+	// Check if the type implements encoding.TextUnmarshaler (for simple values)
+	if v.CanAddr() && d.usesTextUnmarshaler(v.Type()) {
+		pv := v.Addr()
+		if pv.CanInterface() {
+			if u, ok := pv.Interface().(interface{ UnmarshalText([]byte) error }); ok {
+				// Read the element content as text
+				var text strings.Builder
+				for {
+					tok, err := decoder.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						return err
+					}
+					switch t := tok.(type) {
+					case xml.CharData:
+						text.Write(t)
+						if err := d.checkTextLength(text.Len()); err != nil {
+							return err
+						}
+					case xml.EndElement:
+						if err := u.UnmarshalText([]byte(strings.TrimSpace(text.String()))); err != nil {
+							return err
+						}
+						d.normalizeTime(v)
+						return nil
+					case xml.StartElement:
+						// Skip nested elements
+						if err := decoder.Skip(); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		// Empty numeric content is an absent value, leaving the pointer nil
+		if d.isNumericPointer(v.Type()) {
+			text, err := d.readText(decoder)
+			if err != nil {
+				return err
+			}
+			if len(bytes.TrimSpace(text)) == 0 {
+				return nil
+			}
+			return d.setFieldValue(v, string(text))
+		}
+		// Initialize pointer if nil
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		// Decode into the element the pointer points to
+		return d.decodeValue(decoder, v.Elem(), start)
+	case reflect.Struct:
+		return d.decodeStruct(decoder, v, start)
+	case reflect.String:
+		return d.decodeString(decoder, v)
+	case reflect.Bool:
+		return d.decodeBool(decoder, v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return d.decodeInt(decoder, v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return d.decodeUint(decoder, v)
+	case reflect.Float32, reflect.Float64:
+		return d.decodeFloat(decoder, v)
+	case reflect.Map:
+		return d.decodeMap(decoder, v)
+	case reflect.Chan:
+		// Each element is decoded and sent as it is read, for streaming consumers
+		if v.IsNil() || v.Type().ChanDir()&reflect.SendDir == 0 {
+			return fmt.Errorf("cannot send element %s on nil or receive-only channel", start.Name.Local)
+		}
+		if d.closedChans[v.Pointer()] {
+			return fmt.Errorf("cannot send element %s on channel closed when an earlier parent element ended", start.Name.Local)
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decodeValue(decoder, elem, start); err != nil {
+			return err
+		}
+		v.Send(elem)
+		return nil
+	case reflect.Slice:
+		// Pre-grow empty slices to the caller's hint before their first element
+		if d.sliceGrowHint > 0 && v.Cap() == 0 {
+			v.Set(reflect.MakeSlice(v.Type(), 0, d.sliceGrowHint))
+		}
+		// For slices, create a new element and decode into it
+		elemType := v.Type().Elem()
+		elem := reflect.New(elemType).Elem()
+		// Pass the element's position to its ,index field, if any
+		d.elemIndex, d.hasElemIndex = v.Len(), true
+		err := d.decodeValue(decoder, elem, start)
+		d.hasElemIndex = false
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	default:
+		return &UnsupportedTypeError{Type: v.Type()}
+	}
+}
+
+
+// decodeMap decodes the child elements of the current element into a map keyed
+// by their local names. Each value is decoded like a field of the map's value
+// type, so maps of any supported type (e.g., map[string]int) are allowed.
+// A repeated child overwrites the value of a scalar-valued map, while
+// slice-valued maps (e.g., map[string][]string) accumulate every occurrence.
+func (d *Decoder) decodeMap(decoder *xml.Decoder, v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("unsupported map key type: %v", v.Type().Key())
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			key := reflect.ValueOf(t.Name.Local).Convert(v.Type().Key())
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if d.isContainerSlice(elem) {
+				// Append to the values of earlier occurrences of the key
+				if existing := v.MapIndex(key); existing.IsValid() {
+					elem.Set(existing)
+				}
+			}
+			if err := d.decodeElement(decoder, elem, t); err != nil {
+				return fmt.Errorf("map key %q: %w", t.Name.Local, err)
+			}
+			v.SetMapIndex(key, elem)
+		case xml.EndElement:
+			// End of the map element
+			return nil
+		}
+	}
+	return nil
+}
+
+// maxCapacityHint bounds the capacity pre-allocated from a document-provided count,
+// so untrusted input can't force huge allocations up front
+const maxCapacityHint = 1 << 16
+
+// applyCapacityHints pre-sizes empty slice fields tagged with cap=<attr> using
+// the count declared in that attribute of the element
+func (d *Decoder) applyCapacityHints(v reflect.Value, attrs []xml.Attr) error {
+	for _, info := range structFields(v.Type()) {
+		attrName, ok := info.tag.value("cap")
+		if !ok {
+			continue
+		}
+		field := v.Field(info.index)
+		if field.Kind() != reflect.Slice || !field.IsNil() {
+			continue
+		}
+		for _, attr := range attrs {
+			if !d.matchesAttribute(attrName, attr) {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(attr.Value))
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid capacity hint %s=%q for field %s", attrName, attr.Value, info.name)
+			}
+			field.Set(reflect.MakeSlice(field.Type(), 0, min(n, maxCapacityHint)))
+			break
+		}
+	}
+	return nil
+}
+
+// verifyCapacityCounts checks that slice fields tagged with cap=<attr> hold
+// the number of elements declared in that attribute of the element
+func (d *Decoder) verifyCapacityCounts(v reflect.Value, attrs []xml.Attr) error {
+	for _, info := range structFields(v.Type()) {
+		attrName, ok := info.tag.value("cap")
+		if !ok {
+			continue
+		}
+		field := v.Field(info.index)
+		if field.Kind() != reflect.Slice {
+			continue
+		}
+		for _, attr := range attrs {
+			if !d.matchesAttribute(attrName, attr) {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(attr.Value))
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid count %s=%q for field %s", attrName, attr.Value, info.name)
+			}
+			if field.Len() != n {
+				return fmt.Errorf("field %s: %s attribute declares %d elements, got %d", info.name, attrName, n, field.Len())
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// captureSubtree reads the remaining tokens of the element opened by start,
+// returning copies of them with start first and the matching end element last.
+// Copies of CDATA sections are recorded, so replays keep them apart from text.
+func (d *Decoder) captureSubtree(decoder *xml.Decoder, start xml.StartElement) ([]xml.Token, error) {
+	tokens := []xml.Token{start.Copy()}
+	depth := 0
+	for {
+		offset := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		copied := xml.CopyToken(tok)
+		tokens = append(tokens, copied)
+
+		switch tok := tok.(type) {
+		case xml.CharData:
+			if d.isCDATA(decoder, offset, tok) {
+				d.markCDATA(copied.(xml.CharData))
+			}
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				return tokens, nil
+			}
+			depth--
+		}
+	}
+}
+
+// tokenReplay is an xml.TokenReader over previously captured tokens
+type tokenReplay struct {
+	tokens []xml.Token
+}
+
+// Token returns the next captured token
+func (r *tokenReplay) Token() (xml.Token, error) {
+	if len(r.tokens) == 0 {
+		return nil, io.EOF
+	}
+	tok := r.tokens[0]
+	r.tokens = r.tokens[1:]
+	return tok, nil
+}
+
+// newReplayDecoder creates a decoder that reads the captured tokens again.
+// The tokens already carry resolved namespaces, which the decoder leaves intact.
+func newReplayDecoder(tokens []xml.Token) *xml.Decoder {
+	return xml.NewTokenDecoder(&tokenReplay{tokens: tokens})
+}
+
+// decodeStruct decodes an XML element into a struct
+func (d *Decoder) decodeStruct(decoder *xml.Decoder, v reflect.Value, start xml.StartElement) error {
+	// Clear reused structs before populating them
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if r, ok := v.Addr().Interface().(Resettable); ok {
+			r.Reset()
+		}
+	}
+
+	// Close channel fields once the element ends, even on error, so
+	// consumers ranging over them finish
+	defer d.closeChanFields(v)
+
+	// A base=N option applies to the integers of its field, not to those of
+	// a struct within it
+	if d.hasIntBase {
+		d.hasIntBase = false
+		defer func() { d.hasIntBase = true }()
+	}
+
+	// Keep the namespace declarations in scope for ,prefix fields
+	if declaresNamespaces(start.Attr) {
+		d.scopes = append(d.scopes, start.Attr)
+		defer func() { d.scopes = d.scopes[:len(d.scopes)-1] }()
+	}
+
+	// Set XMLName field if present
+	if err := d.setXMLName(v, start); err != nil {
+		return err
+	}
+	d.setPrefixField(v, start)
+
+	// Record the struct's position in its slice, consumed so nested structs don't see it
+	if d.hasElemIndex {
+		d.hasElemIndex = false
+		if indexField := d.findOptionField(v, "index"); indexField.IsValid() {
+			if err := d.setFieldValue(indexField, strconv.Itoa(d.elemIndex)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Then, decode attributes
+	if err := d.decodeAttributes(v, start.Attr); err != nil {
+		return err
+	}
+
+	// Capture the namespace declarations made on this element
+	if err := d.decodeNamespaceDeclarations(v, start.Attr); err != nil {
+		return err
+	}
+
+	// Pre-size slices whose capacity is hinted by an attribute
+	if err := d.applyCapacityHints(v, start.Attr); err != nil {
+		return err
+	}
+
+	// Find special fields
+	chardataField := d.findChardataField(v)
+	cdataField := d.findCDataField(v)
+	innerXMLField := d.findInnerXMLField(v)
+	anyField := d.findAnyField(v)
+	commentField := d.findCommentField(v)
+	textField := d.findTextField(v)
+	coercer := d.findCharDataCoercer(v)
+	// A ,attr,orchardata field falls back to chardata only when its attribute is absent
+	orCharDataField := d.findOrCharDataField(v, start.Attr)
+
+	// If a ,text field is present, collect the text of the whole subtree and
+	// replay the captured tokens so child elements still reach their fields
+	if textField.IsValid() {
+		tokens, err := d.captureSubtree(decoder, start)
+		if err != nil {
+			return err
+		}
+		var text strings.Builder
+		for _, tok := range tokens {
+			if cd, ok := tok.(xml.CharData); ok {
+				text.Write(cd)
+				if err := d.checkTextLength(text.Len()); err != nil {
+					return err
+				}
+			}
+		}
+		if textField.Kind() == reflect.String {
+			textField.SetString(strings.TrimSpace(text.String()))
+		}
+		decoder = newReplayDecoder(tokens)
+		// Consume the replayed start element
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
 
-	var matches []pathFieldInfo
+	// If innerxml is present, capture all inner content as raw XML. Child
+	// elements declare the namespaces they use so the content can be parsed
+	// again on its own.
+	if innerXMLField.IsValid() {
+		var buf strings.Builder
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" || tag == "-" {
-			continue
+		for {
+			tok, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			switch t := tok.(type) {
+			case xml.StartElement:
+				tokens, err := d.captureSubtree(decoder, t)
+				if err != nil {
+					return err
+				}
+				d.writeFragment(&buf, tokens)
+			case xml.EndElement:
+				// End of parent element
+				content := buf.String()
+				if innerXMLField.Kind() == reflect.String {
+					innerXMLField.SetString(content)
+				} else if innerXMLField.Kind() == reflect.Slice && innerXMLField.Type().Elem().Kind() == reflect.Uint8 {
+					innerXMLField.SetBytes([]byte(content))
+				}
+				return d.finalize(v)
+			default:
+				writeMiscToken(&buf, tok)
+			}
+
+			// Enforce the text length limit on the captured markup
+			if err := d.checkTextLength(buf.Len()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Path fields (e.g., "a>b>c") are matched through the type's cached path trie
+	paths := pathTrieFor(v.Type())
+	if paths.err != nil {
+		return paths.err
+	}
+
+	// Accumulate character data and comments
+	var chardata strings.Builder
+	var comments strings.Builder
+
+	// Count children against the schema, if any
+	schemaCounts := d.startSchemaCounts(start)
+
+	// Count child elements for ,count fields
+	counts := d.findCountFields(v)
+
+	// Fields with a default=<value> option, filled if their element is absent
+	defaults := d.findDefaultFields(v)
+
+	// Keys of the elements decoded into dedup=<attr> slices
+	var seenKeys map[dedupKey]bool
+	// Elements decoded into each scalar field, when duplicates are disallowed
+	var occurrences map[int]int
+
+	// Text inside CDATA sections goes to the cdata field, and text outside
+	// them to the chardata field, when the struct has both
+	splitCDATA := chardataField.IsValid() && cdataField.IsValid()
+	var plainText, cdataText strings.Builder
+
+	// Then decode child elements
+	for {
+		offset := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
 		}
 
-		// Parse the tag
-		tagParts := strings.Split(tag, ",")
-		tagName := tagParts[0]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			d.checkSchemaChild(schemaCounts, start, tok)
+			for i := range counts {
+				if d.matchesField(counts[i].name, tok.Name.Local, tok.Name.Space) {
+					counts[i].n++
+				}
+			}
+
+			// Check if this element is the start of any path fields
+			pathNodes := d.matchPathNodes([]*pathNode{paths}, tok)
+
+			if len(pathNodes) > 0 {
+				if d.trace != nil {
+					for _, node := range pathNodes {
+						for _, path := range node.leafPaths() {
+							d.tracef("element %s: descending into path field %q", formatName(tok.Name), path)
+						}
+					}
+				}
+				for _, node := range pathNodes {
+					if err := d.decodePathAttrs(v, node, tok); err != nil {
+						return err
+					}
+				}
+				// A direct field naming the same element (e.g., "country" beside
+				// "country>id") takes precedence and receives the whole element;
+				// the path fields are then decoded from a replay of it
+				if field, info, err := d.findFieldWithTag(v, tok); err == nil {
+					if d.trace != nil {
+						d.tracef("element %s: matched field tag %q", formatName(tok.Name), info.tag.raw)
+					}
+					markMatched(defaults, info)
+					decodeWhole := func(replay *xml.Decoder) error {
+						return d.decodeField(replay, field, info, tok)
+					}
+					if err := d.decodeSharedElement(decoder, v, tok, decodeWhole, pathNodes); err != nil {
+						return err
+					}
+					continue
+				}
+				// Decode all path fields from within this element
+				d.enterElement(tok)
+				if err := d.leaveElement(d.decodePathNodes(decoder, v, pathNodes)); err != nil {
+					return err
+				}
+				continue
+			}
 
-		// Skip special fields
-		if len(tagParts) > 1 {
-			if tagParts[1] == "attr" || tagParts[1] == "chardata" {
+			// Find matching field in struct (non-path fields only at this point)
+			field, info, err := d.findFieldWithTag(v, tok)
+			if err != nil {
+				// Element doesn't match any field
+				// Try to decode into ,any field if present
+				if anyField.IsValid() {
+					if d.trace != nil {
+						d.tracef("element %s: no matching field, decoding into ,any field", formatName(tok.Name))
+					}
+					if err := d.decodeAnyElement(decoder, anyField, tok); err != nil {
+						return err
+					}
+					continue
+				}
+				// Skip unknown elements
+				if d.trace != nil {
+					d.tracef("element %s: no matching field in %s, skipped", formatName(tok.Name), v.Type())
+				}
+				d.recordUnmatched(tok.Name)
+				if err := decoder.Skip(); err != nil {
+					return err
+				}
 				continue
 			}
+			if d.trace != nil {
+				d.tracef("element %s: matched field tag %q", formatName(tok.Name), info.tag.raw)
+			}
+			markMatched(defaults, info)
+
+			// Slices tagged dedup=<attr> keep the first element for each key
+			if key, ok := d.dedupKey(info, tok); ok {
+				if seenKeys[key] {
+					if d.trace != nil {
+						d.tracef("element %s: duplicate %s, skipped", formatName(tok.Name), key.value)
+					}
+					if err := decoder.Skip(); err != nil {
+						return err
+					}
+					continue
+				}
+				if seenKeys == nil {
+					seenKeys = make(map[dedupKey]bool)
+				}
+				seenKeys[key] = true
+			}
+
+			// Scalar fields take one element when duplicates are disallowed
+			// or the first wins
+			if (d.disallowDuplicates || d.firstWins) && !d.collectsElements(field) {
+				if occurrences == nil {
+					occurrences = make(map[int]int)
+				}
+				occurrences[info.index]++
+				if n := occurrences[info.index]; n > 1 {
+					if !d.firstWins {
+						return fmt.Errorf("duplicate element: %s occurrence of <%s> for field %s", ordinal(n), tok.Name.Local, info.name)
+					}
+					if d.trace != nil {
+						d.tracef("element %s: %s occurrence for field %s, skipped", formatName(tok.Name), ordinal(n), info.name)
+					}
+					if err := decoder.Skip(); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if d.skipBadElements {
+				err = d.decodeFieldOrSkip(decoder, field, info, tok)
+			} else {
+				err = d.decodeField(decoder, field, info, tok)
+			}
+			if err != nil {
+				return err
+			}
+
+		case xml.CharData:
+			// Accumulate character data for chardata or cdata field
+			if chardataField.IsValid() || cdataField.IsValid() || coercer != nil || orCharDataField.IsValid() {
+				chardata.Write(tok)
+				if err := d.checkTextLength(chardata.Len()); err != nil {
+					return err
+				}
+			} else if d.noMixedContent && !textField.IsValid() {
+				if text := bytes.TrimSpace(tok); len(text) > 0 {
+					return fmt.Errorf("unexpected text %q in element %s, which has no chardata field", text, start.Name.Local)
+				}
+			}
+			if splitCDATA {
+				if d.isCDATA(decoder, offset, tok) {
+					cdataText.Write(tok)
+				} else {
+					plainText.Write(tok)
+				}
+			}
+
+		case xml.Comment:
+			// Accumulate comments for comment field
+			if commentField.IsValid() {
+				if comments.Len() > 0 {
+					comments.WriteString("\n")
+				}
+				comments.Write(tok)
+			}
+
+		case xml.EndElement:
+			d.endSchemaCounts(schemaCounts, start)
+			for _, c := range counts {
+				if err := d.setFieldValue(c.field, strconv.Itoa(c.n)); err != nil {
+					return withField(err, c.info.name)
+				}
+			}
+			for _, def := range defaults {
+				if def.matched {
+					continue
+				}
+				if d.trace != nil {
+					d.tracef("field %s: element absent, set to default %q", def.info.name, def.value)
+				}
+				restore, err := d.useIntBase(def.info)
+				if err != nil {
+					return err
+				}
+				err = d.setFieldValue(def.field, def.value)
+				restore()
+				if err != nil {
+					return fmt.Errorf("default for field %s: %w", def.info.name, err)
+				}
+			}
+			if d.verifyCounts {
+				if err := d.verifyCapacityCounts(v, start.Attr); err != nil {
+					return err
+				}
+			}
+
+			// Set chardata field if it exists
+			chardataInfo, _ := optionFieldInfo(v.Type(), "chardata")
+			if splitCDATA {
+				if text := strings.TrimSpace(plainText.String()); text != "" {
+					text, err := d.scaleCharData(v, start.Attr, text)
+					if err != nil {
+						return err
+					}
+					if err := d.setCharDataField(chardataField, chardataInfo, text); err != nil {
+						return err
+					}
+				}
+				if cdataText.Len() > 0 {
+					cdataField.SetString(strings.TrimSpace(cdataText.String()))
+				}
+			} else if chardataField.IsValid() && chardata.Len() > 0 {
+				text, err := d.scaleCharData(v, start.Attr, strings.TrimSpace(chardata.String()))
+				if err != nil {
+					return err
+				}
+				if err := d.setCharDataField(chardataField, chardataInfo, text); err != nil {
+					return err
+				}
+			} else if cdataField.IsValid() && chardata.Len() > 0 {
+				// Without a chardata field, the cdata field takes all the text
+				cdataField.SetString(strings.TrimSpace(chardata.String()))
+			}
+			if chardataField.IsValid() && chardata.Len() > 0 {
+				if err := d.callOptionFieldHook(v, "chardata"); err != nil {
+					return err
+				}
+			}
+			// Set comment field if it exists
+			if commentField.IsValid() && comments.Len() > 0 {
+				commentField.SetString(strings.TrimSpace(comments.String()))
+			}
+			// Set the attribute-or-chardata field from text when its attribute was absent
+			if orCharDataField.IsValid() {
+				if text := strings.TrimSpace(chardata.String()); text != "" {
+					info, _ := optionFieldInfo(v.Type(), "orchardata")
+					restore, err := d.useIntBase(info)
+					if err != nil {
+						return err
+					}
+					err = d.setFieldValue(orCharDataField, text)
+					restore()
+					if err != nil {
+						return err
+					}
+				}
+			}
+			// Let the struct coerce its character data now that attributes are set
+			if coercer != nil {
+				if err := coercer.CoerceCharData(strings.TrimSpace(chardata.String())); err != nil {
+					return err
+				}
+			}
+			// End of this struct
+			return d.finalize(v)
+		}
+	}
+
+	return nil
+}
+
+// timeType is the reflect.Type of time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// durationType is the reflect.Type of time.Duration
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// normalizeTime converts a decoded time.Time to the configured location
+func (d *Decoder) normalizeTime(v reflect.Value) {
+	if d.timeLocation != nil && v.Type() == timeType {
+		v.Set(reflect.ValueOf(v.Interface().(time.Time).In(d.timeLocation)))
+	}
+}
+
+// closeChanFields closes the non-nil channel fields of the struct, once each
+// when the struct's element repeats
+func (d *Decoder) closeChanFields(v reflect.Value) {
+	for _, info := range structFields(v.Type()) {
+		if info.typ.Kind() != reflect.Chan || info.typ.ChanDir()&reflect.SendDir == 0 {
+			continue
 		}
-		if strings.Contains(tag, "attr") || strings.HasPrefix(tagName, "xmlns") {
+		field := v.Field(info.index)
+		if field.IsNil() || d.closedChans[field.Pointer()] {
 			continue
 		}
+		field.Close()
+		if d.closedChans == nil {
+			d.closedChans = make(map[uintptr]bool)
+		}
+		d.closedChans[field.Pointer()] = true
+	}
+}
+
+// setCharDataField sets the ,chardata field described by info from the
+// element's trimmed text, applying its base=N option, if any
+func (d *Decoder) setCharDataField(v reflect.Value, info fieldInfo, text string) error {
+	restore, err := d.useIntBase(info)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return d.setCharDataValue(v, text)
+}
+
+// setCharDataValue sets a ,chardata field from the element's trimmed text.
+// Non-string fields (e.g., an int amount beside a currency attribute) are
+// parsed like attribute values and left untouched when the text is empty.
+func (d *Decoder) setCharDataValue(v reflect.Value, text string) error {
+	switch {
+	case d.unmarshalsItself(v.Type()):
+		// Custom types (e.g., decimals) parse the text even when string or byte based
+		if text != "" {
+			return d.setFieldValue(v, text)
+		}
+	case v.Kind() == reflect.String:
+		v.SetString(d.internString(text))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes([]byte(text))
+	case text != "":
+		return d.setFieldValue(v, text)
+	}
+	return nil
+}
+
+// elementCount counts the child elements matching a ,count field
+type elementCount struct {
+	info  fieldInfo
+	field reflect.Value
+	name  string // tag name of the counted elements
+	n     int
+}
+
+// findCountFields returns counters for the struct's count fields, which take
+// the number of child elements named in their tag (e.g., "item,count") or in
+// their count option (e.g., ",count=item"). Every matching element is counted,
+// including those a dedup=<attr> slice drops.
+func (d *Decoder) findCountFields(v reflect.Value) []elementCount {
+	var counts []elementCount
+	for _, info := range structFields(v.Type()) {
+		name, ok := info.tag.value("count")
+		if !ok {
+			if !info.tag.has("count") {
+				continue
+			}
+			name = d.fieldTagName(info)
+		}
+		counts = append(counts, elementCount{info: info, field: v.Field(info.index), name: name})
+	}
+	return counts
+}
+
+// fieldDefault is the default value of a field, applied when no child
+// element matched it
+type fieldDefault struct {
+	info    fieldInfo
+	field   reflect.Value
+	value   string
+	matched bool
+}
 
-		// Check if this is a path field
-		if !strings.Contains(tagName, ">") {
+// findDefaultFields returns the struct's element fields carrying a
+// default=<value> option (e.g., "theme,default=light"). Path fields reject
+// the option, see unsupportedPathOptions.
+func (d *Decoder) findDefaultFields(v reflect.Value) []fieldDefault {
+	var defaults []fieldDefault
+	for _, info := range structFields(v.Type()) {
+		value, ok := info.tag.value("default")
+		if !ok || !info.isElement() || info.tag.isPath() {
 			continue
 		}
+		defaults = append(defaults, fieldDefault{info: info, field: v.Field(info.index), value: value})
+	}
+	return defaults
+}
+
+// markMatched records that an element matched the field, so its default is
+// not applied
+func markMatched(defaults []fieldDefault, info fieldInfo) {
+	for i := range defaults {
+		if defaults[i].info.index == info.index {
+			defaults[i].matched = true
+		}
+	}
+}
+
+// collectsElements reports whether a field takes any number of elements, like
+// slices, maps, and channels, rather than a single one
+func (d *Decoder) collectsElements(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.Map, reflect.Chan:
+		return !d.unmarshalsItself(field.Type())
+	}
+	return d.isContainerSlice(field)
+}
+
+// ordinal returns the English ordinal of n, e.g. "second" or "12th"
+func ordinal(n int) string {
+	words := []string{"zeroth", "first", "second", "third", "fourth", "fifth", "sixth", "seventh", "eighth", "ninth", "tenth"}
+	if n >= 0 && n < len(words) {
+		return words[n]
+	}
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// dedupKey identifies an element of a slice field tagged dedup=<attr> by the
+// value of that attribute
+type dedupKey struct {
+	field int
+	value string
+}
+
+// dedupKey returns the key of an element matched to a dedup=<attr> field, and
+// false if the field isn't de-duplicated or the element lacks the attribute
+func (d *Decoder) dedupKey(info fieldInfo, start xml.StartElement) (dedupKey, bool) {
+	attrName, ok := info.tag.value("dedup")
+	if !ok {
+		return dedupKey{}, false
+	}
+	for _, attr := range start.Attr {
+		if d.matchesAttribute(attrName, attr) {
+			return dedupKey{field: info.index, value: attr.Value}, true
+		}
+	}
+	return dedupKey{}, false
+}
+
+// decodeField decodes a matched element into a field found by findFieldWithTag
+func (d *Decoder) decodeField(decoder *xml.Decoder, field reflect.Value, info fieldInfo, start xml.StartElement) error {
+	restore, err := d.useIntBase(info)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// Fields tagged "name,attr=x" take the x attribute of the element
+	attrName, isAttr := info.tag.value("attr")
+	_, isScaled := info.tag.value("scale")
+	switch {
+	case isAttr:
+		err = d.decodeElementAttr(decoder, field, start, attrName)
+	case info.tag.has("presence"):
+		// Fields tagged "name,presence" are true when the element is present,
+		// whatever its content; *bool fields stay nil when it is absent
+		err = setPresence(field)
+		if err == nil {
+			err = decoder.Skip()
+		}
+	case isScaled:
+		// Fields tagged "name,scale=x" shift the decimal point of the text by
+		// the x attribute of the element
+		err = d.decodeScaledElement(decoder, field, info, start)
+	case info.tag.has("list") && d.isContainerSlice(field):
+		// Fields tagged "name,list" split the element's text like xs:list
+		err = d.decodeListElement(decoder, field)
+	case info.tag.has("token") && field.Kind() == reflect.String:
+		// Fields tagged "name,token" collapse whitespace like xs:token
+		err = d.decodeTokenElement(decoder, field)
+	case info.tag.has("char"):
+		// Fields tagged "name,char" take the code point of a single character
+		err = d.decodeCharElement(decoder, field)
+	default:
+		err = d.decodeElement(decoder, field, start)
+	}
+	if err != nil {
+		return withField(err, info.name)
+	}
+	return d.callFieldHook(info.name, field)
+}
 
-		// Get first segment
-		pathSegments := strings.Split(tagName, ">")
-		firstSegment := pathSegments[0]
+// decodeFieldOrSkip decodes a matched element like decodeField, but from a
+// captured copy, so that if it fails the element is skipped, the field
+// restored, and the error recorded, see WithSkipBadElements
+func (d *Decoder) decodeFieldOrSkip(decoder *xml.Decoder, field reflect.Value, info fieldInfo, start xml.StartElement) error {
+	tokens, err := d.captureSubtree(decoder, start)
+	if err != nil {
+		return err
+	}
+	replay := newReplayDecoder(tokens)
+	// Consume the replayed start element
+	if _, err := replay.Token(); err != nil {
+		return err
+	}
 
-		// Check if first segment matches the element
-		if d.matchesField(firstSegment, elemLocal, elemNS) {
-			matches = append(matches, pathFieldInfo{
-				field: v.Field(i),
-				tag:   tagName,
-			})
+	saved := reflect.New(field.Type()).Elem()
+	saved.Set(field)
+	if err := d.decodeField(replay, field, info, start); err != nil {
+		if d.trace != nil {
+			d.tracef("element %s: %v, skipped", formatName(start.Name), err)
 		}
+		field.Set(saved)
+		d.skipped = append(d.skipped, fmt.Errorf("element %s: %w", start.Name.Local, err))
 	}
+	return nil
+}
 
-	return matches
+// decodeScaledElement decodes the element's text into field after applying the
+// scale given by the attribute named in the field's scale=<attr> option
+func (d *Decoder) decodeScaledElement(decoder *xml.Decoder, field reflect.Value, info fieldInfo, start xml.StartElement) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	scaled, err := d.scaleText(info, start.Attr, string(bytes.TrimSpace(text)))
+	if err != nil {
+		return err
+	}
+	if scaled == "" && d.isNumericPointer(field.Type()) {
+		return nil
+	}
+	return d.setFieldValue(field, scaled)
 }
 
-// decodeMultiplePathFields decodes multiple fields that share the same parent path element
-func (d *Decoder) decodeMultiplePathFields(decoder *xml.Decoder, pathFields []pathFieldInfo) error {
-	// Track which fields have been decoded
-	foundFields := make([]bool, len(pathFields))
+// scaleCharData applies the scale=<attr> option of the struct's ,chardata
+// field, if any, to its text
+func (d *Decoder) scaleCharData(v reflect.Value, attrs []xml.Attr, text string) (string, error) {
+	for _, info := range structFields(v.Type()) {
+		if info.tag.has("chardata") && !info.tag.has("attr") {
+			return d.scaleText(info, attrs, text)
+		}
+	}
+	return text, nil
+}
 
-	// Navigate through the parent element
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
+// scaleText moves the decimal point of text left by the value of the scale
+// attribute named in the field's scale=<attr> option, so <amount scale="2">
+// 1999</amount> gives "19.99". Negative scales move it right. Text is returned
+// unchanged when the field has no scale option or the attribute is absent.
+// The shift is exact, but float fields then round the result to the nearest
+// binary value, so amounts should be decoded into decimal types.
+func (d *Decoder) scaleText(info fieldInfo, attrs []xml.Attr, text string) (string, error) {
+	attrName, ok := info.tag.value("scale")
+	if !ok || text == "" {
+		return text, nil
+	}
+	for _, attr := range attrs {
+		if !d.matchesAttribute(attrName, attr) {
+			continue
 		}
+		scale, err := strconv.Atoi(strings.TrimSpace(attr.Value))
 		if err != nil {
-			return err
+			return "", fmt.Errorf("invalid scale %s=%q for field %s", attrName, attr.Value, info.name)
 		}
+		if scale < -maxScale || scale > maxScale {
+			return "", fmt.Errorf("scale %s=%d for field %s is outside the range -%d to %d", attrName, scale, info.name, maxScale, maxScale)
+		}
+		scaled, ok := shiftDecimalPoint(text, scale)
+		if !ok {
+			return "", fmt.Errorf("cannot scale %q for field %s: not a decimal number", text, info.name)
+		}
+		return scaled, nil
+	}
+	return text, nil
+}
 
-		switch t := tok.(type) {
-		case xml.StartElement:
-			elemNS := t.Name.Space
-			elemLocal := t.Name.Local
-
-			// Find all fields whose next segment matches this element
-			var matchingFields []pathFieldInfo
-			var matchingIndices []int
-			matchedAny := false
+// maxScale bounds the scale attributes taken from documents, which would
+// otherwise pad numbers with any number of zeros
+const maxScale = 100
 
-			for i, pf := range pathFields {
-				if foundFields[i] {
-					continue
-				}
+// shiftDecimalPoint divides the decimal number in text by 10^scale exactly,
+// by moving its decimal point, and reports false if text isn't a number
+func shiftDecimalPoint(text string, scale int) (string, bool) {
+	sign := ""
+	if text[0] == '-' || text[0] == '+' {
+		sign, text = strings.TrimPrefix(text[:1], "+"), text[1:]
+	}
+	whole, frac, _ := strings.Cut(text, ".")
+	digits := whole + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", false
+	}
+	point := len(whole) - scale
+	if point < 1 {
+		digits = strings.Repeat("0", 1-point) + digits
+		point = 1
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	if point == len(digits) {
+		return sign + digits, true
+	}
+	return sign + digits[:point] + "." + digits[point:], true
+}
 
-				// Split path and get segments
-				pathSegments := strings.Split(pf.tag, ">")
-				if len(pathSegments) < 2 {
-					continue
-				}
+// decodeListElement appends the whitespace-separated items of the element's
+// text (e.g., <dimensions>10 20 30</dimensions>) to the slice, parsing each
+// into the slice's element type
+func (d *Decoder) decodeListElement(decoder *xml.Decoder, field reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	for _, item := range strings.Fields(string(text)) {
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := d.setFieldValue(elem, item); err != nil {
+			return fmt.Errorf("list item %q: %w", item, err)
+		}
+		field.Set(reflect.Append(field, elem))
+	}
+	return nil
+}
 
-				nextSegment := pathSegments[1]
+// decodeTokenElement decodes the element's text into a string field with
+// whitespace collapsed, as for xs:token
+func (d *Decoder) decodeTokenElement(decoder *xml.Decoder, field reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	field.SetString(collapseWhitespace(string(text)))
+	return nil
+}
 
-				if d.matchesField(nextSegment, elemLocal, elemNS) {
-					matchedAny = true
-					if len(pathSegments) == 2 {
-						// This is the final segment - decode into the field
-						if err := d.decodeElement(decoder, pf.field, t); err != nil {
-							return err
-						}
-						foundFields[i] = true
-					} else {
-						// More segments remaining - collect for recursive processing
-						remainingPath := strings.Join(pathSegments[1:], ">")
-						matchingFields = append(matchingFields, pathFieldInfo{
-							field: pf.field,
-							tag:   remainingPath,
-						})
-						matchingIndices = append(matchingIndices, i)
-					}
-				}
-			}
+// decodeCharElement decodes the element's text, a single character, into a
+// rune or byte field as its code point
+func (d *Decoder) decodeCharElement(decoder *xml.Decoder, field reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	return setCharValue(field, string(bytes.TrimSpace(text)))
+}
 
-			// If we have fields with deeper paths, recursively process them
-			if len(matchingFields) > 0 {
-				if err := d.decodeMultiplePathFields(decoder, matchingFields); err != nil {
-					return err
-				}
-				// Mark all matching fields as found
-				for _, idx := range matchingIndices {
-					foundFields[idx] = true
-				}
-			} else if !matchedAny {
-				// No fields matched this element - skip it
-				if err := decoder.Skip(); err != nil {
-					return err
-				}
-			}
+// setCharValue sets a rune or byte field to the code point of s, which must
+// be a single character; bytes only take code points up to 255
+func setCharValue(field reflect.Value, s string) error {
+	r, size := utf8.DecodeRuneInString(s)
+	if s == "" || size != len(s) || r == utf8.RuneError {
+		return fmt.Errorf("%q is not a single character", s)
+	}
+	switch field.Kind() {
+	case reflect.Int32:
+		field.SetInt(int64(r))
+	case reflect.Uint8:
+		if r > 0xFF {
+			return fmt.Errorf("character %q does not fit in a byte", r)
+		}
+		field.SetUint(uint64(r))
+	default:
+		return &UnsupportedTypeError{Type: field.Type()}
+	}
+	return nil
+}
 
-		case xml.EndElement:
-			// Reached end of parent element
-			return nil
+// setPresence sets a bool or *bool ,presence field to true
+func setPresence(field reflect.Value) error {
+	if field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Bool {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
 		}
+		field = field.Elem()
+	}
+	if field.Kind() != reflect.Bool {
+		return fmt.Errorf("presence option needs a bool or *bool field, not %s", field.Type())
 	}
+	field.SetBool(true)
+	return nil
+}
 
+// collapseWhitespace trims s and replaces each inner run of whitespace with a
+// single space, like the xs:token type's whitespace="collapse" facet
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// callFieldHook passes a populated field to the hook set with WithFieldHook
+func (d *Decoder) callFieldHook(name string, field reflect.Value) error {
+	if d.fieldHook == nil {
+		return nil
+	}
+	if err := d.fieldHook(name, field); err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
 	return nil
 }
 
-// decodeStruct decodes an XML element into a struct
-func (d *Decoder) decodeStruct(decoder *xml.Decoder, v reflect.Value, start xml.StartElement) error {
-	// First, set XMLName field if present
-	if err := d.setXMLName(v, start); err != nil {
+// decodeSharedElement decodes an element matched both by a whole-element field
+// and by path fields below it: the element is captured, decoded whole by
+// decodeWhole, then replayed to extract the path fields from its children
+func (d *Decoder) decodeSharedElement(decoder *xml.Decoder, v reflect.Value, start xml.StartElement, decodeWhole func(*xml.Decoder) error, nodes []*pathNode) error {
+	tokens, err := d.captureSubtree(decoder, start)
+	if err != nil {
 		return err
 	}
 
-	// Then, decode attributes
-	if err := d.decodeAttributes(v, start.Attr); err != nil {
+	replay := newReplayDecoder(tokens)
+	// Consume the replayed start element
+	if _, err := replay.Token(); err != nil {
+		return err
+	}
+	if err := decodeWhole(replay); err != nil {
 		return err
 	}
 
-	// Find special fields
-	chardataField := d.findChardataField(v)
-	cdataField := d.findCDataField(v)
-	innerXMLField := d.findInnerXMLField(v)
-	anyField := d.findAnyField(v)
-	commentField := d.findCommentField(v)
-
-	// If innerxml is present, capture all inner content as raw XML
-	if innerXMLField.IsValid() {
-		var buf strings.Builder
-		enc := xml.NewEncoder(&buf)
-		depth := 0
+	replay = newReplayDecoder(tokens)
+	if _, err := replay.Token(); err != nil {
+		return err
+	}
+	d.enterElement(start)
+	return d.leaveElement(d.decodePathNodes(replay, v, nodes))
+}
 
-		for {
-			tok, err := decoder.Token()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
+// decodeElementAttr decodes the named attribute of a matched element into the
+// field and skips the element's content. Slice fields accumulate one value per
+// element, so repeated elements like <tag id="x"/> collect all their ids.
+func (d *Decoder) decodeElementAttr(decoder *xml.Decoder, field reflect.Value, start xml.StartElement, attrName string) error {
+	for _, attr := range start.Attr {
+		if !d.matchesAttribute(attrName, attr) {
+			continue
+		}
+		if d.isContainerSlice(field) {
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := d.setFieldValue(elem, attr.Value); err != nil {
 				return err
 			}
-
-			switch t := tok.(type) {
-			case xml.StartElement:
-				depth++
-				if err := enc.EncodeToken(t); err != nil {
-					return err
-				}
-			case xml.EndElement:
-				if depth == 0 {
-					// End of parent element
-					if err := enc.Flush(); err != nil {
-						return err
-					}
-					content := buf.String()
-					if innerXMLField.Kind() == reflect.String {
-						innerXMLField.SetString(content)
-					} else if innerXMLField.Kind() == reflect.Slice && innerXMLField.Type().Elem().Kind() == reflect.Uint8 {
-						innerXMLField.SetBytes([]byte(content))
-					}
-					return nil
-				}
-				depth--
-				if err := enc.EncodeToken(t); err != nil {
-					return err
-				}
-			case xml.CharData, xml.Comment, xml.ProcInst, xml.Directive:
-				if err := enc.EncodeToken(xml.CopyToken(t)); err != nil {
-					return err
-				}
-			}
+			field.Set(reflect.Append(field, elem))
+		} else if err := d.setFieldValue(field, attr.Value); err != nil {
+			return err
 		}
-		return nil
+		break
 	}
+	return decoder.Skip()
+}
 
-	// Accumulate character data and comments
-	var chardata strings.Builder
-	var comments strings.Builder
-
-	// Then decode child elements
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+// callOptionFieldHook passes the field found by findOptionField to the field hook
+func (d *Decoder) callOptionFieldHook(v reflect.Value, option string) error {
+	if d.fieldHook == nil {
+		return nil
+	}
+	for _, info := range structFields(v.Type()) {
+		if info.tag.has(option) && !info.tag.has("attr") {
+			return d.callFieldHook(info.name, v.Field(info.index))
 		}
+	}
+	return nil
+}
 
-		switch tok := tok.(type) {
-		case xml.StartElement:
-			// Check if this element is the start of any path fields
-			pathFields := d.findAllPathFieldsWithPrefix(v, tok)
+// optionFieldInfo returns the first field of the struct type t whose tag
+// carries the option
+func optionFieldInfo(t reflect.Type, option string) (fieldInfo, bool) {
+	for _, info := range structFields(t) {
+		if info.tag.has(option) {
+			return info, true
+		}
+	}
+	return fieldInfo{}, false
+}
 
-			if len(pathFields) > 0 {
-				// Decode all path fields from within this element
-				if err := d.decodeMultiplePathFields(decoder, pathFields); err != nil {
-					return err
-				}
-				continue
-			}
+// findOptionField finds the first struct field whose tag carries the option,
+// ignoring attribute fields (e.g., ",any,attr" is not an ,any field)
+func (d *Decoder) findOptionField(v reflect.Value, option string) reflect.Value {
+	for _, info := range structFields(v.Type()) {
+		if info.tag.has(option) && !info.tag.has("attr") {
+			return v.Field(info.index)
+		}
+	}
+	return reflect.Value{}
+}
 
-			// Find matching field in struct (non-path fields only at this point)
-			field, _, err := d.findFieldWithTag(v, tok)
-			if err != nil {
-				// Element doesn't match any field
-				// Try to decode into ,any field if present
-				if anyField.IsValid() {
-					if err := d.decodeAnyElement(decoder, anyField, tok); err != nil {
-						return err
-					}
-					continue
-				}
-				// Skip unknown elements
-				if err := decoder.Skip(); err != nil {
-					return err
-				}
+// decodeNamespaceDeclarations sets the ,xmlns field, a map[string]string, to
+// the namespace declarations on the element, keyed by prefix with "" for the
+// default namespace. The field is left untouched when there are none.
+func (d *Decoder) decodeNamespaceDeclarations(v reflect.Value, attrs []xml.Attr) error {
+	for _, info := range structFields(v.Type()) {
+		if !info.tag.has("xmlns") {
+			continue
+		}
+		field := v.Field(info.index)
+		if field.Kind() != reflect.Map || field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+			return &UnsupportedTypeError{Type: field.Type(), Field: info.name}
+		}
+		var declared reflect.Value
+		for _, attr := range attrs {
+			var prefix string
+			switch {
+			case attr.Name.Space == "xmlns":
+				prefix = attr.Name.Local
+			case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+				prefix = ""
+			default:
 				continue
 			}
-
-			// Decode into the field normally
-			// Note: path fields are already handled above by findAllPathFieldsWithPrefix
-			if err := d.decodeElement(decoder, field, tok); err != nil {
-				return err
-			}
-
-		case xml.CharData:
-			// Accumulate character data for chardata or cdata field
-			if chardataField.IsValid() {
-				chardata.Write(tok)
-			} else if cdataField.IsValid() {
-				chardata.Write(tok)
-			}
-
-		case xml.Comment:
-			// Accumulate comments for comment field
-			if commentField.IsValid() {
-				if comments.Len() > 0 {
-					comments.WriteString("\n")
-				}
-				comments.Write(tok)
-			}
-
-		case xml.EndElement:
-			// Set chardata field if it exists
-			if chardataField.IsValid() && chardata.Len() > 0 {
-				chardataField.SetString(strings.TrimSpace(chardata.String()))
-			} else if cdataField.IsValid() && chardata.Len() > 0 {
-				// Set cdata field (cdata and chardata are mutually exclusive)
-				cdataField.SetString(strings.TrimSpace(chardata.String()))
-			}
-			// Set comment field if it exists
-			if commentField.IsValid() && comments.Len() > 0 {
-				commentField.SetString(strings.TrimSpace(comments.String()))
+			if !declared.IsValid() {
+				declared = reflect.MakeMap(field.Type())
 			}
-			// End of this struct
-			return nil
+			declared.SetMapIndex(reflect.ValueOf(prefix).Convert(field.Type().Key()), reflect.ValueOf(attr.Value).Convert(field.Type().Elem()))
+		}
+		if declared.IsValid() {
+			field.Set(declared)
 		}
+		return nil
 	}
-
 	return nil
 }
 
 // findChardataField finds the struct field marked with ,chardata tag
 func (d *Decoder) findChardataField(v reflect.Value) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
-			continue
-		}
-		// Check if this is a chardata field (e.g., ",chardata")
-		if strings.Contains(tag, "chardata") {
-			return v.Field(i)
-		}
-	}
-	return reflect.Value{}
+	return d.findOptionField(v, "chardata")
 }
 
 // findCDataField finds the struct field marked with ,cdata tag
 func (d *Decoder) findCDataField(v reflect.Value) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
-			continue
-		}
-		// Check if this is a cdata field (e.g., ",cdata")
-		if strings.Contains(tag, "cdata") && !strings.Contains(tag, "chardata") {
-			return v.Field(i)
-		}
-	}
-	return reflect.Value{}
+	return d.findOptionField(v, "cdata")
 }
 
 // findInnerXMLField finds the struct field marked with ,innerxml tag
 func (d *Decoder) findInnerXMLField(v reflect.Value) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
-			continue
-		}
-		if strings.Contains(tag, "innerxml") {
-			return v.Field(i)
-		}
-	}
-	return reflect.Value{}
+	return d.findOptionField(v, "innerxml")
 }
 
 // findAnyField finds the struct field marked with ,any tag
 func (d *Decoder) findAnyField(v reflect.Value) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
+	return d.findOptionField(v, "any")
+}
+
+// findCommentField finds the struct field marked with ,comment tag
+func (d *Decoder) findCommentField(v reflect.Value) reflect.Value {
+	return d.findOptionField(v, "comment")
+}
+
+// findOrCharDataField finds the struct field marked with ,attr,orchardata whose
+// attribute is absent from attrs, meaning its value should come from chardata
+func (d *Decoder) findOrCharDataField(v reflect.Value, attrs []xml.Attr) reflect.Value {
+	for _, info := range structFields(v.Type()) {
+		if !info.tag.has("orchardata") {
 			continue
 		}
-		// Look for ,any but not ,any,attr
-		if strings.Contains(tag, ",any") && !strings.Contains(tag, ",any,attr") {
-			return v.Field(i)
+		for _, attr := range attrs {
+			if d.matchesAttribute(d.fieldTagName(info), attr) {
+				// Attribute present, already decoded by decodeAttributes
+				return reflect.Value{}
+			}
 		}
+		return v.Field(info.index)
 	}
 	return reflect.Value{}
 }
 
-// findCommentField finds the struct field marked with ,comment tag
-func (d *Decoder) findCommentField(v reflect.Value) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
-			continue
+// findTextField finds the struct field marked with ,text tag
+func (d *Decoder) findTextField(v reflect.Value) reflect.Value {
+	return d.findOptionField(v, "text")
+}
+
+// finalize calls Finalize on the struct if it implements Finalizer
+func (d *Decoder) finalize(v reflect.Value) error {
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if f, ok := v.Addr().Interface().(Finalizer); ok {
+			return f.Finalize()
 		}
-		if strings.Contains(tag, "comment") {
-			return v.Field(i)
+	}
+	return nil
+}
+
+// findCharDataCoercer returns the struct as a CharDataCoercer if it implements the interface
+func (d *Decoder) findCharDataCoercer(v reflect.Value) CharDataCoercer {
+	if v.CanAddr() {
+		pv := v.Addr()
+		if pv.CanInterface() {
+			if c, ok := pv.Interface().(CharDataCoercer); ok {
+				return c
+			}
 		}
 	}
-	return reflect.Value{}
+	return nil
 }
 
 // setXMLName sets the XMLName field if present in the struct
@@ -610,82 +2392,114 @@ func (d *Decoder) decodeAnyElement(decoder *xml.Decoder, v reflect.Value, start
 	return decoder.Skip()
 }
 
-// findFieldWithTag finds the struct field that matches the XML element and returns the field and its tag
-func (d *Decoder) findFieldWithTag(v reflect.Value, start xml.StartElement) (reflect.Value, string, error) {
-	t := v.Type()
-
+// findFieldWithTag finds the struct field that matches the XML element and returns the field and its description
+func (d *Decoder) findFieldWithTag(v reflect.Value, start xml.StartElement) (reflect.Value, fieldInfo, error) {
 	// start.Name.Space contains the full namespace URI (already resolved by xml.Decoder)
 	// start.Name.Local contains the local element name
 	elemNS := start.Name.Space
 	elemLocal := start.Name.Local
 
-	// Search through struct fields
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" || tag == "-" {
+	// Search through struct fields, skipping special fields (attributes, chardata, etc.)
+	// and path fields, which are matched through the path trie.
+	// Fields taking an attribute of the matched element (e.g., "tag,attr=id") are element fields.
+	// Exact names take precedence over wildcards (e.g., "ns2:*").
+	fields := structFields(v.Type())
+	wildcard := -1
+	for i, info := range fields {
+		if !info.isElement() || info.tag.isPath() {
 			continue
 		}
 
-		// Parse the tag
-		tagParts := strings.Split(tag, ",")
-		tagName := tagParts[0]
-
-		// Skip special fields (attributes, chardata, etc.)
-		if len(tagParts) > 1 {
-			if tagParts[1] == "attr" || tagParts[1] == "chardata" || strings.HasPrefix(tagParts[0], "xmlns") {
+		// Check if this field matches the element
+		if d.matchesField(d.fieldTagName(info), elemLocal, elemNS) {
+			if info.tag.local == "*" {
+				if wildcard < 0 {
+					wildcard = i
+				}
 				continue
 			}
-		}
-		if strings.Contains(tag, "attr") || strings.HasPrefix(tagName, "xmlns") {
-			continue
-		}
-
-		// Handle path syntax (e.g., "ram:OriginTradeCountry>ram:ID")
-		// For matching, we only check the first segment
-		firstSegment := tagName
-		if strings.Contains(tagName, ">") {
-			pathSegments := strings.Split(tagName, ">")
-			firstSegment = pathSegments[0]
-		}
-
-		// Check if this field matches the element
-		if d.matchesField(firstSegment, elemLocal, elemNS) {
-			return v.Field(i), tagName, nil
+			return v.Field(info.index), info, nil
 		}
 	}
+	if wildcard >= 0 {
+		return v.Field(fields[wildcard].index), fields[wildcard], nil
+	}
 
-	return reflect.Value{}, "", fmt.Errorf("no field found for element %s (ns: %s)", elemLocal, elemNS)
+	return reflect.Value{}, fieldInfo{}, fmt.Errorf("no field found for element %s (ns: %s)", elemLocal, elemNS)
 }
 
+// fieldTagName returns the name a field is matched by: its tag's name, or its
+// Go field name, lowercased under WithLowercaseFieldNames
+func (d *Decoder) fieldTagName(info fieldInfo) string {
+	if d.lowercaseFieldNames && !info.named {
+		return strings.ToLower(info.tag.name)
+	}
+	return info.tag.name
+}
 
-// matchesField checks if a struct tag matches an element
+// matchesField checks if a struct tag matches an element. A "*" local name
+// (e.g., "ns2:*") matches any element in the tag's namespace, and a tag in
+// Clark notation (e.g., "{http://other/ns}id") matches its namespace URI.
 func (d *Decoder) matchesField(tag, elemLocal, elemNS string) bool {
+	if d.baseNamespace != "" || d.undeclaredPrefixes != nil {
+		elemNS = d.resolveNamespace(elemNS)
+	}
+
+	// Clark notation (e.g., "{http://other/ns}id") names the namespace URI
+	// directly, bypassing the namespace map
+	if uri, tagLocal, ok := splitClark(tag); ok {
+		return uri == elemNS && (tagLocal == elemLocal || tagLocal == "*")
+	}
+
+	// Escaped colons (e.g., `ext\:code`) name the element literally, whatever
+	// its namespace
+	if literal, ok := unescapeColons(tag); ok {
+		return matchesLiteralName(literal, elemLocal, elemNS)
+	}
+
 	// Handle tags like "ns1:profile"
-	if strings.Contains(tag, ":") {
-		parts := strings.SplitN(tag, ":", 2)
-		tagPrefix := parts[0]
-		tagLocal := parts[1]
+	if tagPrefix, tagLocal := splitPrefix(tag); tagPrefix != "" {
+		if tagLocal == "*" {
+			tagLocal = elemLocal
+		}
+		// Lenient matching accepts unqualified elements for prefixed tags
+		if d.lenientNamespaces && elemNS == "" && tagLocal == elemLocal {
+			return true
+		}
 
 		// Look up the expected namespace URL for this prefix
 		expectedNS, ok := d.namespaces[tagPrefix]
 		if !ok {
 			// Unknown prefix in tag
+			if d.trace != nil && tagLocal == elemLocal {
+				d.tracef("tag %q: prefix %q is not in the namespace map", tag, tagPrefix)
+			}
 			return false
 		}
 
 		// Match: local name must match AND namespace URL must match
+		if d.trace != nil && tagLocal == elemLocal && expectedNS != elemNS {
+			d.tracef("tag %q: element namespace %q does not match %q", tag, elemNS, expectedNS)
+		}
 		return tagLocal == elemLocal && expectedNS == elemNS
 	}
 
 	// For tags without prefix (e.g., "name", "email")
 	// Match if local names match and element is in default namespace
-	if tag != elemLocal {
+	if tag != elemLocal && tag != "*" {
 		return false
 	}
 
 	// Check if element is in default namespace
 	defaultNS, hasDefault := d.namespaces[""]
+	if d.lenientNamespaces {
+		// Lenient matching accepts unqualified elements, and any namespace
+		// when no default is configured
+		return elemNS == "" || elemNS == defaultNS || !hasDefault
+	}
+	if d.trace != nil && elemNS != defaultNS {
+		d.tracef("tag %q: element namespace %q does not match default namespace %q", tag, elemNS, defaultNS)
+	}
 	if hasDefault {
 		return elemNS == defaultNS
 	}
@@ -694,55 +2508,104 @@ func (d *Decoder) matchesField(tag, elemLocal, elemNS string) bool {
 	return elemNS == ""
 }
 
+// matchesLiteralName reports whether a name written as literal in the document
+// was read as local in namespace space. xml.Decoder reads a colon as a prefix
+// separator, leaving a prefix it can't resolve in place of the namespace URI,
+// so "ext:code" with no ext declaration is read as local "code" in "ext".
+// Names with a leading or trailing colon keep it in their local part.
+func matchesLiteralName(literal, local, space string) bool {
+	return local == literal || (space != "" && space+":"+local == literal)
+}
+
+// resolveNamespace maps an undeclared prefix to its URI set with
+// WithUndeclaredPrefixURIs, or resolves a relative namespace URI against the
+// base set with WithBaseNamespaceURI, returning other namespaces unchanged
+func (d *Decoder) resolveNamespace(ns string) string {
+	if ns == "" || ns == "xmlns" {
+		return ns
+	}
+	if uri, ok := d.undeclaredPrefixes[ns]; ok {
+		return uri
+	}
+	if d.baseNamespace == "" {
+		return ns
+	}
+	if resolved, ok := d.resolvedNamespaces[ns]; ok {
+		return resolved
+	}
+	resolved := ns
+	base, err := url.Parse(d.baseNamespace)
+	if ref, refErr := url.Parse(ns); err == nil && refErr == nil && !ref.IsAbs() {
+		resolved = base.ResolveReference(ref).String()
+	}
+	if d.resolvedNamespaces == nil {
+		d.resolvedNamespaces = make(map[string]string)
+	}
+	d.resolvedNamespaces[ns] = resolved
+	return resolved
+}
+
+// tracef writes a debug trace line; callers check d.trace first to avoid
+// formatting costs when tracing is disabled
+func (d *Decoder) tracef(format string, args ...any) {
+	fmt.Fprintf(d.trace, "xmlctx: "+format+"\n", args...)
+}
+
+// formatName formats an element name as {namespace}local for diagnostics
+func formatName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
 // decodeAttributes decodes XML attributes into struct fields
 func (d *Decoder) decodeAttributes(v reflect.Value, attrs []xml.Attr) error {
-	t := v.Type()
+	fields := structFields(v.Type())
 	matchedAttrs := make(map[int]bool) // Track which attrs were matched
 	var anyAttrField reflect.Value
-	var anyAttrFieldIdx = -1
+	var includeXMLNS bool
 
 	// First pass: find the ,any,attr field if present
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" {
-			continue
-		}
-		// Check for ,any,attr
-		if strings.Contains(tag, ",any,attr") {
-			anyAttrField = v.Field(i)
-			anyAttrFieldIdx = i
+	for _, info := range fields {
+		if info.tag.isAnyAttr() {
+			anyAttrField = v.Field(info.index)
+			includeXMLNS = info.tag.has("includexmlns")
 			break
 		}
 	}
 
-	// Second pass: match specific attributes
-	for i := 0; i < t.NumField(); i++ {
-		if i == anyAttrFieldIdx {
-			continue // Skip the ,any,attr field in this pass
-		}
-
-		field := t.Field(i)
-		tag := field.Tag.Get("xml")
-		if tag == "" || !strings.Contains(tag, "attr") {
-			continue
-		}
-
-		// Skip ,any,attr which was handled above
-		if strings.Contains(tag, ",any,attr") {
+	// Second pass: match specific attributes (e.g., "id,attr" or "xmlns:ns1,attr").
+	// Like encoding/xml, ",attr" uses the Go field name. Fields taking an
+	// attribute of a child element (e.g., "tag,attr=id") carry no attr flag.
+	for _, info := range fields {
+		if !info.tag.isAttr() {
 			continue
 		}
 
-		// Parse attribute tag (e.g., "id,attr" or "xmlns:ns1,attr")
-		tagParts := strings.Split(tag, ",")
-		attrName := tagParts[0]
-
 		// Find matching attribute (including xmlns declarations)
 		for attrIdx, attr := range attrs {
-			if d.matchesAttribute(attrName, attr) {
+			if d.matchesAttribute(d.fieldTagName(info), attr) {
 				// Set the field value
-				fv := v.Field(i)
-				if err := d.setFieldValue(fv, attr.Value); err != nil {
+				fv := v.Field(info.index)
+				value := attr.Value
+				if info.tag.has("token") {
+					value = collapseWhitespace(value)
+				}
+				restore, err := d.useIntBase(info)
+				if err != nil {
+					return err
+				}
+				if info.tag.has("char") {
+					err = setCharValue(fv, value)
+				} else {
+					err = d.setFieldValue(fv, value)
+				}
+				restore()
+				if err != nil {
+					return withField(err, info.name)
+				}
+				if err := d.callFieldHook(info.name, fv); err != nil {
 					return err
 				}
 				matchedAttrs[attrIdx] = true
@@ -751,19 +2614,63 @@ func (d *Decoder) decodeAttributes(v reflect.Value, attrs []xml.Attr) error {
 		}
 	}
 
-	// Third pass: collect unmatched attributes into ,any,attr field
+	// Third pass: route attributes with a dotted prefix (e.g., addr.city="SF"),
+	// without the prefix, to the struct field tagged with it ("addr.,attr-prefix")
+	for _, info := range fields {
+		if !info.tag.has("attr-prefix") {
+			continue
+		}
+		var routed []xml.Attr
+		for attrIdx, attr := range attrs {
+			if local, ok := strings.CutPrefix(attr.Name.Local, info.tag.name); ok && local != "" {
+				routed = append(routed, xml.Attr{Name: xml.Name{Space: attr.Name.Space, Local: local}, Value: attr.Value})
+				matchedAttrs[attrIdx] = true
+			}
+		}
+		if len(routed) == 0 {
+			continue
+		}
+		fv := v.Field(info.index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() != reflect.Struct {
+			return &UnsupportedTypeError{Type: fv.Type(), Field: info.name}
+		}
+		if err := d.decodeAttributes(fv, routed); err != nil {
+			return withField(err, info.name)
+		}
+		if err := d.callFieldHook(info.name, v.Field(info.index)); err != nil {
+			return err
+		}
+	}
+
+	// Fourth pass: collect unmatched attributes into ,any,attr field. Namespace
+	// declarations are left out unless the field is tagged includexmlns.
 	if anyAttrField.IsValid() && anyAttrField.CanSet() {
 		var unmatchedAttrs []xml.Attr
 		for i, attr := range attrs {
-			if !matchedAttrs[i] {
-				unmatchedAttrs = append(unmatchedAttrs, attr)
+			if matchedAttrs[i] || (!includeXMLNS && isNamespaceDeclaration(attr)) {
+				continue
 			}
+			unmatchedAttrs = append(unmatchedAttrs, attr)
 		}
 
 		if len(unmatchedAttrs) > 0 {
-			// The field should be []xml.Attr
-			if anyAttrField.Type() == reflect.TypeOf([]xml.Attr{}) {
+			switch t := anyAttrField.Type(); {
+			case t == reflect.TypeOf([]xml.Attr{}):
 				anyAttrField.Set(reflect.ValueOf(unmatchedAttrs))
+			case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String:
+				// Maps are keyed by local name alone, so of attributes sharing
+				// a local name in different namespaces the last one wins
+				collected := reflect.MakeMapWithSize(t, len(unmatchedAttrs))
+				for _, attr := range unmatchedAttrs {
+					collected.SetMapIndex(reflect.ValueOf(attr.Name.Local).Convert(t.Key()), reflect.ValueOf(attr.Value).Convert(t.Elem()))
+				}
+				anyAttrField.Set(collected)
 			}
 		}
 	}
@@ -771,6 +2678,12 @@ func (d *Decoder) decodeAttributes(v reflect.Value, attrs []xml.Attr) error {
 	return nil
 }
 
+// isNamespaceDeclaration reports whether attr declares a namespace, either
+// the default (xmlns="...") or a prefix (xmlns:ns1="...")
+func isNamespaceDeclaration(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
 // matchesAttribute checks if a struct tag matches an attribute
 func (d *Decoder) matchesAttribute(tag string, attr xml.Attr) bool {
 	// attr.Name.Space contains the namespace URI (if any)
@@ -789,11 +2702,26 @@ func (d *Decoder) matchesAttribute(tag string, attr xml.Attr) bool {
 		}
 	}
 
+	if d.baseNamespace != "" || d.undeclaredPrefixes != nil {
+		attr.Name.Space = d.resolveNamespace(attr.Name.Space)
+	}
+
+	// Clark notation names the attribute's namespace URI directly
+	if uri, tagLocal, ok := splitClark(tag); ok {
+		return uri == attr.Name.Space && tagLocal == attr.Name.Local
+	}
+
+	// Escaped colons name the attribute literally
+	if literal, ok := unescapeColons(tag); ok {
+		return matchesLiteralName(literal, attr.Name.Local, attr.Name.Space)
+	}
+
 	// Handle namespaced attributes like "ns1:visibility"
-	if strings.Contains(tag, ":") {
-		parts := strings.SplitN(tag, ":", 2)
-		tagPrefix := parts[0]
-		tagLocal := parts[1]
+	if tagPrefix, tagLocal := splitPrefix(tag); tagPrefix != "" {
+		// Lenient matching accepts unqualified attributes for prefixed tags
+		if d.lenientNamespaces && attr.Name.Space == "" && tagLocal == attr.Name.Local {
+			return true
+		}
 
 		// Look up expected namespace for prefix
 		expectedNS, ok := d.namespaces[tagPrefix]
@@ -821,146 +2749,369 @@ func (d *Decoder) setFieldValue(v reflect.Value, s string) error {
 		}
 	}
 
-	// Check if the type implements encoding.TextUnmarshaler
+	// Check if the type implements XMLSetter
 	if v.CanAddr() {
+		pv := v.Addr()
+		if pv.CanInterface() {
+			if setter, ok := pv.Interface().(XMLSetter); ok {
+				return setter.SetXML(s)
+			}
+		}
+	}
+
+	// Check if the type implements encoding.TextUnmarshaler
+	if v.CanAddr() && d.usesTextUnmarshaler(v.Type()) {
 		pv := v.Addr()
 		if pv.CanInterface() {
 			if u, ok := pv.Interface().(interface{ UnmarshalText([]byte) error }); ok {
-				return u.UnmarshalText([]byte(s))
+				if err := u.UnmarshalText([]byte(s)); err != nil {
+					return err
+				}
+				d.normalizeTime(v)
+				return nil
 			}
 		}
 	}
 
 	// Handle pointer types
 	if v.Kind() == reflect.Pointer {
+		// Empty numeric values are absent, leaving the pointer nil
+		if d.isNumericPointer(v.Type()) && strings.TrimSpace(s) == "" {
+			return nil
+		}
+		// Nil pointers are only set once the value parses, so an invalid
+		// value leaves them nil
 		if v.IsNil() {
-			v.Set(reflect.New(v.Type().Elem()))
+			elem := reflect.New(v.Type().Elem())
+			if err := d.setFieldValue(elem.Elem(), s); err != nil {
+				return err
+			}
+			v.Set(elem)
+			return nil
 		}
 		return d.setFieldValue(v.Elem(), s)
 	}
 
+	// Durations are integers of nanoseconds, like other int64 values, or use
+	// Go's duration syntax (e.g., "30m" or "1h30m")
+	if v.Type() == durationType {
+		text := strings.TrimSpace(s)
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			v.SetInt(n)
+			return nil
+		}
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("failed to parse duration: %w", err)
+		}
+		v.SetInt(int64(duration))
+		return nil
+	}
+
 	switch v.Kind() {
 	case reflect.String:
-		v.SetString(s)
+		v.SetString(d.internString(s))
 	case reflect.Bool:
-		v.SetBool(s == "true")
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i, err := strconv.ParseInt(s, 10, 64)
+		text, err := d.numericText(s)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.ParseInt(d.stripBasePrefix(text), d.integerBase(), 64)
 		if err != nil {
 			return fmt.Errorf("failed to parse integer: %w", err)
 		}
 		v.SetInt(i)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		i, err := strconv.ParseUint(s, 10, 64)
+		text, err := d.numericText(s)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.ParseUint(d.stripBasePrefix(text), d.integerBase(), 64)
 		if err != nil {
 			return fmt.Errorf("failed to parse unsigned integer: %w", err)
 		}
 		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		text, err := d.numericText(s)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("failed to parse float: %w", err)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if !d.isContainerSlice(v) {
+			return &UnsupportedTypeError{Type: v.Type()}
+		}
+		// List values (e.g., ids="a,b,c" or ids="a b c") are split and
+		// each item is decoded into a new slice element
+		items := strings.FieldsFunc(s, isListSeparator)
+		list := reflect.MakeSlice(v.Type(), 0, len(items))
+		for _, item := range items {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.setFieldValue(elem, item); err != nil {
+				return err
+			}
+			list = reflect.Append(list, elem)
+		}
+		v.Set(list)
 	default:
-		return fmt.Errorf("unsupported field type: %v", v.Kind())
+		return &UnsupportedTypeError{Type: v.Type()}
 	}
 	return nil
 }
 
-// decodeString decodes character data into a string field
-func (d *Decoder) decodeString(decoder *xml.Decoder, v reflect.Value) error {
-	var s strings.Builder
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+// isNumericPointer reports whether t is a pointer to an integer or float type
+// without custom unmarshaling, for which empty content means the value is absent
+func (d *Decoder) isNumericPointer(t reflect.Type) bool {
+	if t.Kind() != reflect.Pointer || d.unmarshalsItself(t.Elem()) {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
 
-		switch t := tok.(type) {
-		case xml.CharData:
-			s.Write(t)
-		case xml.EndElement:
-			v.SetString(strings.TrimSpace(s.String()))
-			return nil
+// internBytes returns b as a string, shared with earlier identical values
+// when string interning is enabled
+func (d *Decoder) internBytes(b []byte) string {
+	if d.interned == nil {
+		return string(b)
+	}
+	// The map lookup with a converted key doesn't allocate
+	if s, ok := d.interned[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	d.interned[s] = s
+	return s
+}
+
+// internString returns s, or an earlier identical value when string
+// interning is enabled
+func (d *Decoder) internString(s string) string {
+	if d.interned == nil {
+		return s
+	}
+	if interned, ok := d.interned[s]; ok {
+		return interned
+	}
+	d.interned[s] = s
+	return s
+}
+
+// numericText returns the text to parse for a numeric value, trimming surrounding
+// whitespace (which may come from expanded character references like &#32;)
+// and mapping boolean literals to 1 and 0 when bool-numeric coercion is enabled.
+// With WithStrictNumbers, surrounding whitespace is an error instead.
+func (d *Decoder) numericText(s string) (string, error) {
+	trimmed := strings.TrimSpace(s)
+	if d.strictNumbers && trimmed != s {
+		return "", fmt.Errorf("number %q has surrounding whitespace", s)
+	}
+	if d.boolNumeric {
+		switch trimmed {
+		case "true":
+			return "1", nil
+		case "false":
+			return "0", nil
 		}
 	}
+	return trimmed, nil
+}
+
+// checkTextLength returns an error if n bytes of text exceed the configured limit
+func (d *Decoder) checkTextLength(n int) error {
+	if d.maxTextLength > 0 && n > d.maxTextLength {
+		return fmt.Errorf("element text exceeds maximum length of %d bytes", d.maxTextLength)
+	}
 	return nil
 }
 
-// decodeBool decodes character data into a bool field
-func (d *Decoder) decodeBool(decoder *xml.Decoder, v reflect.Value) error {
-	var s strings.Builder
+// isListSeparator reports whether r separates items in a list value
+func isListSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// readText reads the character data of the current element up to its end
+// element, ignoring comments and skipping nested elements. The returned bytes
+// are untrimmed, so numbers can be checked for padding, and are backed by the
+// decoder's scratch buffer, so they are only valid until the next call. Leaf decoders don't
+// recurse while reading, so a single buffer per Decoder is safe to reuse.
+func (d *Decoder) readText(decoder *xml.Decoder) ([]byte, error) {
+	d.scratch = d.scratch[:0]
 	for {
 		tok, err := decoder.Token()
 		if err == io.EOF {
-			break
+			return nil, io.ErrUnexpectedEOF
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		switch t := tok.(type) {
 		case xml.CharData:
-			s.Write(t)
+			d.scratch = append(d.scratch, t...)
+			if err := d.checkTextLength(len(d.scratch)); err != nil {
+				return nil, err
+			}
+		case xml.StartElement:
+			// Text of nested elements isn't part of the value
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
 		case xml.EndElement:
-			str := strings.TrimSpace(s.String())
-			v.SetBool(str == "true")
-			return nil
+			return d.scratch, nil
 		}
 	}
+}
+
+// decodeString decodes character data into a string field
+func (d *Decoder) decodeString(decoder *xml.Decoder, v reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	v.SetString(d.internBytes(bytes.TrimSpace(text)))
+	return nil
+}
+
+// decodeBool decodes character data into a bool field
+func (d *Decoder) decodeBool(decoder *xml.Decoder, v reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	v.SetBool(string(bytes.TrimSpace(text)) == "true")
 	return nil
 }
 
+// parseBool parses an attribute's boolean as strconv.ParseBool does, ignoring
+// surrounding whitespace. Besides the lexical forms of xs:boolean ("true",
+// "false", "1", and "0") it accepts "t", "f", "TRUE", "True", and the like.
+func parseBool(s string) (bool, error) {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse boolean: %w", err)
+	}
+	return b, nil
+}
+
+// useIntBase makes the integers of the field parse in the base of its base=N
+// option, if any, returning a function that restores the previous base. Base
+// 0 detects the base from a 0x, 0o, or 0b prefix, as strconv.ParseInt does.
+func (d *Decoder) useIntBase(info fieldInfo) (restore func(), err error) {
+	value, ok := info.tag.value("base")
+	if !ok {
+		return func() {}, nil
+	}
+	base, err := strconv.Atoi(value)
+	if err != nil || base < 0 || base == 1 || base > 36 {
+		return nil, fmt.Errorf("invalid base %q for field %s", value, info.name)
+	}
+	intBase, hasIntBase := d.intBase, d.hasIntBase
+	d.intBase, d.hasIntBase = base, true
+	return func() { d.intBase, d.hasIntBase = intBase, hasIntBase }, nil
+}
+
+// integerBase returns the base to parse integers in, 10 unless the field
+// being decoded has a base=N option
+func (d *Decoder) integerBase() int {
+	if d.hasIntBase {
+		return d.intBase
+	}
+	return 10
+}
+
+// basePrefixes are the prefixes marking integers in a base, which fields
+// with that fixed base accept as strconv does with base 0
+var basePrefixes = map[int]string{16: "0x", 8: "0o", 2: "0b"}
+
+// stripBasePrefix removes the prefix of the field's fixed base from text, if
+// present after an optional sign, so base=16 accepts both "1F4" and "0x1F4"
+func (d *Decoder) stripBasePrefix(text string) string {
+	if !d.hasIntBase {
+		return text
+	}
+	prefix, ok := basePrefixes[d.intBase]
+	if !ok {
+		return text
+	}
+	sign, digits := "", text
+	if len(text) > 0 && (text[0] == '-' || text[0] == '+') {
+		sign, digits = text[:1], text[1:]
+	}
+	if len(digits) > len(prefix) && strings.EqualFold(digits[:len(prefix)], prefix) {
+		return sign + digits[len(prefix):]
+	}
+	return text
+}
+
 // decodeInt decodes character data into an int field
 func (d *Decoder) decodeInt(decoder *xml.Decoder, v reflect.Value) error {
-	var s strings.Builder
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		switch t := tok.(type) {
-		case xml.CharData:
-			s.Write(t)
-		case xml.EndElement:
-			str := strings.TrimSpace(s.String())
-			i, err := strconv.ParseInt(str, 10, 64)
-			if err != nil {
-				return fmt.Errorf("failed to parse integer: %w", err)
-			}
-			v.SetInt(i)
-			return nil
-		}
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	if v.Type() == durationType {
+		return d.setFieldValue(v, string(text))
+	}
+	number, err := d.numericText(string(text))
+	if err != nil {
+		return err
+	}
+	i, err := strconv.ParseInt(d.stripBasePrefix(number), d.integerBase(), 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse integer: %w", err)
 	}
+	v.SetInt(i)
 	return nil
 }
 
 // decodeUint decodes character data into a uint field
 func (d *Decoder) decodeUint(decoder *xml.Decoder, v reflect.Value) error {
-	var s strings.Builder
-	for {
-		tok, err := decoder.Token()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	number, err := d.numericText(string(text))
+	if err != nil {
+		return err
+	}
+	i, err := strconv.ParseUint(d.stripBasePrefix(number), d.integerBase(), 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse unsigned integer: %w", err)
+	}
+	v.SetUint(i)
+	return nil
+}
 
-		switch t := tok.(type) {
-		case xml.CharData:
-			s.Write(t)
-		case xml.EndElement:
-			str := strings.TrimSpace(s.String())
-			i, err := strconv.ParseUint(str, 10, 64)
-			if err != nil {
-				return fmt.Errorf("failed to parse unsigned integer: %w", err)
-			}
-			v.SetUint(i)
-			return nil
-		}
+// decodeFloat decodes character data into a float field
+func (d *Decoder) decodeFloat(decoder *xml.Decoder, v reflect.Value) error {
+	text, err := d.readText(decoder)
+	if err != nil {
+		return err
+	}
+	number, err := d.numericText(string(text))
+	if err != nil {
+		return err
+	}
+	f, err := strconv.ParseFloat(number, v.Type().Bits())
+	if err != nil {
+		return fmt.Errorf("failed to parse float: %w", err)
 	}
+	v.SetFloat(f)
 	return nil
 }
@@ -2,11 +2,18 @@ package xmlctx_test
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/invopop/xmlctx"
 )
@@ -531,6 +538,45 @@ func TestInvalidNamespaces(t *testing.T) {
 	}
 }
 
+// TestUndeclaredPrefixURIs tests matching elements whose prefixes the
+// document never declares by mapping the prefixes to namespace URIs
+func TestUndeclaredPrefixURIs(t *testing.T) {
+	data, err := os.ReadFile("testdata/invalid/03_undeclared_prefix.xml")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	var user User
+	err = xmlctx.Unmarshal(data, &user,
+		xmlctx.WithNamespaces(map[string]string{
+			"":    DefaultNS,
+			"ns1": NS1URL,
+			"ns2": NS2URL,
+		}),
+		xmlctx.WithUndeclaredPrefixURIs(map[string]string{"prf": NS1URL}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if user.Profile.Bio != "Software engineer and open source enthusiast" {
+		t.Errorf("Profile.Bio: got %q", user.Profile.Bio)
+	}
+	if len(user.Profile.Tags) != 3 {
+		t.Errorf("Profile.Tags: got %v, want 3 tags", user.Profile.Tags)
+	}
+	if user.Settings.Notification.Frequency != "daily" {
+		t.Errorf("Settings.Notification.Frequency: got %q, want daily", user.Settings.Notification.Frequency)
+	}
+	// addr is not mapped, so its elements still don't match
+	if user.Address != nil && user.Address.City != "" {
+		t.Errorf("Expected Address.City empty, got: %s", user.Address.City)
+	}
+	if user.Name != "John Doe" {
+		t.Errorf("Name: got %q, want John Doe", user.Name)
+	}
+}
+
 // TestDecodeErrors tests error handling in Decode
 func TestDecodeErrors(t *testing.T) {
 	t.Run("non-pointer", func(t *testing.T) {
@@ -705,15 +751,15 @@ func TestInvalidUintConversions(t *testing.T) {
 // TestUnsupportedTypes tests error handling for unsupported field types
 func TestUnsupportedTypes(t *testing.T) {
 	type Unsupported struct {
-		XMLName xml.Name `xml:"test"`
-		Value   float64  `xml:"value,attr"`
+		XMLName xml.Name   `xml:"test"`
+		Value   complex128 `xml:"value,attr"`
 	}
 
 	xmlData := []byte(`<test value="3.14"></test>`)
 	var test Unsupported
 	err := xmlctx.Unmarshal(xmlData, &test, xmlctx.WithNamespaces(map[string]string{}))
 	if err == nil {
-		t.Error("Expected error for unsupported type (float64), got nil")
+		t.Error("Expected error for unsupported type (complex128), got nil")
 	}
 }
 
@@ -770,23 +816,23 @@ func TestBooleanValues(t *testing.T) {
 // TestUnsupportedElementType tests decoding into unsupported element types
 func TestUnsupportedElementType(t *testing.T) {
 	type UnsupportedElem struct {
-		XMLName xml.Name `xml:"test"`
-		Value   float64  `xml:"value"`
+		XMLName xml.Name   `xml:"test"`
+		Value   complex128 `xml:"value"`
 	}
 
 	xmlData := []byte(`<test><value>3.14</value></test>`)
 	var test UnsupportedElem
 	err := xmlctx.Unmarshal(xmlData, &test, xmlctx.WithNamespaces(map[string]string{}))
 	if err == nil {
-		t.Error("Expected error for unsupported element type (float64), got nil")
+		t.Error("Expected error for unsupported element type (complex128), got nil")
 	}
 }
 
 // TestSliceOfUnsupportedTypes tests error propagation in slice decoding
 func TestSliceOfUnsupportedTypes(t *testing.T) {
 	type SliceTest struct {
-		XMLName xml.Name  `xml:"test"`
-		Values  []float64 `xml:"value"`
+		XMLName xml.Name     `xml:"test"`
+		Values  []complex128 `xml:"value"`
 	}
 
 	xmlData := []byte(`<test><value>1.1</value></test>`)
@@ -797,6 +843,66 @@ func TestSliceOfUnsupportedTypes(t *testing.T) {
 	}
 }
 
+// TestFloatTypes tests decoding float32 and float64 values from attributes,
+// elements, pointers, and slices
+func TestFloatTypes(t *testing.T) {
+	type Measure struct {
+		XMLName  xml.Name  `xml:"measure"`
+		Ratio    float32   `xml:"ratio,attr"`
+		Weight   float64   `xml:"weight"`
+		Height   *float64  `xml:"height"`
+		Depth    *float64  `xml:"depth"`
+		Readings []float64 `xml:"reading"`
+	}
+
+	xmlData := []byte(`<measure ratio="0.5">
+		<weight> 12.75 </weight>
+		<height>1e3</height>
+		<depth></depth>
+		<reading>-1.5</reading>
+		<reading>2</reading>
+	</measure>`)
+
+	var m Measure
+	if err := xmlctx.Unmarshal(xmlData, &m); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if m.Ratio != 0.5 {
+		t.Errorf("Ratio: got %v, want 0.5", m.Ratio)
+	}
+	if m.Weight != 12.75 {
+		t.Errorf("Weight: got %v, want 12.75", m.Weight)
+	}
+	if m.Height == nil || *m.Height != 1000 {
+		t.Errorf("Height: got %v, want 1000", m.Height)
+	}
+	// Empty content leaves float pointers nil, like integer pointers
+	if m.Depth != nil {
+		t.Errorf("Depth: got %v, want nil", *m.Depth)
+	}
+	if !reflect.DeepEqual(m.Readings, []float64{-1.5, 2}) {
+		t.Errorf("Readings: got %v, want [-1.5 2]", m.Readings)
+	}
+
+	for _, bad := range []string{
+		`<measure><weight>abc</weight></measure>`,
+		`<measure><weight></weight></measure>`,
+		`<measure ratio="abc"/>`,
+		`<measure ratio="1e39"/>`,
+	} {
+		m = Measure{}
+		err := xmlctx.Unmarshal([]byte(bad), &m)
+		if err == nil {
+			t.Errorf("Expected error for %s, got nil", bad)
+			continue
+		}
+		var numErr *strconv.NumError
+		if !errors.As(err, &numErr) {
+			t.Errorf("Error for %s should wrap a strconv.NumError, got: %v", bad, err)
+		}
+	}
+}
+
 // TestStringPointer tests string pointer decoding
 func TestStringPointer(t *testing.T) {
 	type StrPtrTest struct {
@@ -1510,6 +1616,108 @@ func TestStructWithoutCharDataField(t *testing.T) {
 	}
 }
 
+// TestNoMixedContent tests rejecting stray text in structs without a chardata
+// field with WithNoMixedContent
+func TestNoMixedContent(t *testing.T) {
+	type NoCharData struct {
+		XMLName xml.Name `xml:"test"`
+		Value   string   `xml:"value"`
+	}
+	type WithCharData struct {
+		XMLName xml.Name `xml:"test"`
+		Text    string   `xml:",chardata"`
+		Value   string   `xml:"value"`
+	}
+
+	stray := []byte(`<test>
+		<value>data</value>More text
+	</test>`)
+
+	var test NoCharData
+	err := xmlctx.Unmarshal(stray, &test, xmlctx.WithNoMixedContent())
+	if err == nil {
+		t.Fatal("Expected error for stray text, got nil")
+	}
+	if !strings.Contains(err.Error(), `"More text"`) {
+		t.Errorf("Error should quote the text, got: %v", err)
+	}
+
+	// Whitespace between elements is allowed
+	test = NoCharData{}
+	if err := xmlctx.Unmarshal([]byte("<test>\n\t<value>data</value>\n</test>"), &test, xmlctx.WithNoMixedContent()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	// A chardata field takes the text
+	var mixed WithCharData
+	if err := xmlctx.Unmarshal(stray, &mixed, xmlctx.WithNoMixedContent()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if mixed.Value != "data" {
+		t.Errorf("Value: got %s, want data", mixed.Value)
+	}
+}
+
+// TestSkipBadElements tests skipping child elements that fail to decode with
+// WithSkipBadElements
+func TestSkipBadElements(t *testing.T) {
+	type Dimensions struct {
+		Width  int `xml:"width"`
+		Height int `xml:"height"`
+	}
+	type Product struct {
+		XMLName    xml.Name   `xml:"product"`
+		Name       string     `xml:"name"`
+		Stock      int        `xml:"stock"`
+		Price      int        `xml:"price"`
+		Sizes      []int      `xml:"size"`
+		Dimensions Dimensions `xml:"dimensions"`
+	}
+
+	xmlData := []byte(`<product>
+		<name>Widget</name>
+		<stock>abc</stock>
+		<size>1</size><size>x</size><size>3</size>
+		<dimensions><width>10</width><height>tall</height></dimensions>
+		<price>250</price>
+	</product>`)
+
+	var product Product
+	if err := xmlctx.Unmarshal(xmlData, &product); err == nil {
+		t.Fatal("Expected error for bad stock, got nil")
+	}
+
+	product = Product{Stock: 5}
+	dec := xmlctx.NewDecoder(strings.NewReader(string(xmlData)), xmlctx.WithSkipBadElements())
+	if err := dec.Decode(&product); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if product.Name != "Widget" || product.Price != 250 {
+		t.Errorf("got Name %q and Price %d, want Widget and 250", product.Name, product.Price)
+	}
+	// The skipped element leaves the field as it was
+	if product.Stock != 5 {
+		t.Errorf("Stock: got %d, want 5", product.Stock)
+	}
+	if !reflect.DeepEqual(product.Sizes, []int{1, 3}) {
+		t.Errorf("Sizes: got %v, want [1 3]", product.Sizes)
+	}
+	// Bad elements are skipped at the innermost level
+	if product.Dimensions.Width != 10 {
+		t.Errorf("Dimensions.Width: got %d, want 10", product.Dimensions.Width)
+	}
+
+	skipped := dec.SkippedErrors()
+	if len(skipped) != 3 {
+		t.Fatalf("SkippedErrors: got %v, want 3 errors", skipped)
+	}
+	for i, name := range []string{"stock", "size", "height"} {
+		if !strings.HasPrefix(skipped[i].Error(), "element "+name+":") {
+			t.Errorf("SkippedErrors[%d]: got %v, want element %s", i, skipped[i], name)
+		}
+	}
+}
+
 // TestCharDataFieldEmpty tests chardata field with empty content
 func TestCharDataFieldEmpty(t *testing.T) {
 	type EmptyCharData struct {
@@ -1614,6 +1822,57 @@ func TestBoolVariations(t *testing.T) {
 	}
 }
 
+// TestBoolPointerAttributes tests the three states of *bool attributes: nil
+// when absent, and true or false as parsed by strconv.ParseBool when present
+func TestBoolPointerAttributes(t *testing.T) {
+	type Flags struct {
+		XMLName xml.Name `xml:"flags"`
+		Active  *bool    `xml:"active,attr"`
+		Plain   bool     `xml:"plain,attr"`
+	}
+
+	tests := []struct {
+		xml  string
+		want *bool
+	}{
+		{`<flags/>`, nil},
+		{`<flags active="true"/>`, boolPtr(true)},
+		{`<flags active="1"/>`, boolPtr(true)},
+		{`<flags active="false"/>`, boolPtr(false)},
+		{`<flags active="0"/>`, boolPtr(false)},
+		{`<flags active=" 1 "/>`, boolPtr(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.xml, func(t *testing.T) {
+			var flags Flags
+			if err := xmlctx.Unmarshal([]byte(tt.xml), &flags); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(flags.Active, tt.want) {
+				t.Errorf("Active: got %v, want %v", flags.Active, tt.want)
+			}
+		})
+	}
+
+	var flags Flags
+	if err := xmlctx.Unmarshal([]byte(`<flags plain="1"/>`), &flags); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !flags.Plain {
+		t.Error("Plain should be true")
+	}
+
+	flags = Flags{}
+	err := xmlctx.Unmarshal([]byte(`<flags active="yes"/>`), &flags)
+	if err == nil {
+		t.Fatal("Expected error for invalid boolean, got nil")
+	}
+	if flags.Active != nil {
+		t.Errorf("Active: got %v, want nil", *flags.Active)
+	}
+}
+
 // TestSliceOfStructs tests slices containing structs
 func TestSliceOfStructs(t *testing.T) {
 	type Item struct {
@@ -1776,20 +2035,18 @@ func TestComplexNestedNamespaces(t *testing.T) {
 	}
 }
 
-// TestEdgeCaseTagFormats tests edge case tag formats that should be skipped
+// TestEdgeCaseTagFormats tests edge case tag formats
 func TestEdgeCaseTagFormats(t *testing.T) {
 	type EdgeCaseStruct struct {
 		XMLName xml.Name `xml:"test"`
-		// These unusual tag formats should be skipped when finding element fields
 		AttrField   string `xml:"attrField"` // Contains "attr" but not as a flag
-		XmlnsField  string `xml:"xmlnsField"` // Starts with "xmlns"
+		XmlnsField  string `xml:"xmlnsField"` // Starts with the reserved "xmlns" and is skipped
 		NormalField string `xml:"normal"`
 	}
 
-	// Only "normal" should match as an element field
 	xmlData := []byte(`<test>
 		<normal>value</normal>
-		<attrField>should not match</attrField>
+		<attrField>matched</attrField>
 		<xmlnsField>should not match</xmlnsField>
 	</test>`)
 
@@ -1802,10 +2059,11 @@ func TestEdgeCaseTagFormats(t *testing.T) {
 	if test.NormalField != "value" {
 		t.Errorf("NormalField: got %s, want value", test.NormalField)
 	}
-	// Fields with "attr" or starting with "xmlns" in the tag name should be skipped
-	if test.AttrField != "" {
-		t.Errorf("AttrField should be empty, got %s", test.AttrField)
+	// Only tag options mark attributes, so element names may contain "attr"
+	if test.AttrField != "matched" {
+		t.Errorf("AttrField: got %s, want matched", test.AttrField)
 	}
+	// Element names starting with "xmlns" are reserved and skipped
 	if test.XmlnsField != "" {
 		t.Errorf("XmlnsField should be empty, got %s", test.XmlnsField)
 	}
@@ -2233,6 +2491,75 @@ func TestComments(t *testing.T) {
 	}
 }
 
+// TestAnyAttrIncludeXMLNS tests that ,any,attr leaves out namespace
+// declarations unless tagged includexmlns, keeping document order
+func TestAnyAttrIncludeXMLNS(t *testing.T) {
+	type Plain struct {
+		XMLName xml.Name   `xml:"element"`
+		Attrs   []xml.Attr `xml:",any,attr"`
+	}
+	type Raw struct {
+		XMLName xml.Name   `xml:"element"`
+		Attrs   []xml.Attr `xml:",any,attr,includexmlns"`
+	}
+
+	xmlData := []byte(`<element xmlns="http://example.com" id="1" xmlns:ext="http://example.com/ext" ext:kind="a"/>`)
+	opt := xmlctx.WithNamespaces(map[string]string{"": "http://example.com", "ext": "http://example.com/ext"})
+
+	var plain Plain
+	if err := xmlctx.Unmarshal(xmlData, &plain, opt); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	var got []string
+	for _, attr := range plain.Attrs {
+		got = append(got, attr.Name.Space+" "+attr.Name.Local)
+	}
+	want := []string{" id", "http://example.com/ext kind"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Attrs: got %q, want %q", got, want)
+	}
+
+	var raw Raw
+	if err := xmlctx.Unmarshal(xmlData, &raw, opt); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	got = nil
+	for _, attr := range raw.Attrs {
+		got = append(got, attr.Name.Space+" "+attr.Name.Local+"="+attr.Value)
+	}
+	want = []string{
+		" xmlns=http://example.com",
+		" id=1",
+		"xmlns ext=http://example.com/ext",
+		"http://example.com/ext kind=a",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Attrs: got %q, want %q", got, want)
+	}
+}
+
+// TestAnyAttrMap tests collecting unmatched attributes into a map keyed by
+// local name, ignoring their namespaces
+func TestAnyAttrMap(t *testing.T) {
+	type Element struct {
+		XMLName xml.Name          `xml:"element"`
+		ID      string            `xml:"id,attr"`
+		Attrs   map[string]string `xml:",any,attr"`
+	}
+
+	xmlData := []byte(`<element xmlns:a="urn:a" xmlns:b="urn:b" id="1" a:lang="en" status="ok" b:lang="fr"/>`)
+
+	var elem Element
+	if err := xmlctx.Unmarshal(xmlData, &elem); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	// b:lang comes last, so it wins over a:lang
+	want := map[string]string{"lang": "fr", "status": "ok"}
+	if !reflect.DeepEqual(elem.Attrs, want) {
+		t.Errorf("Attrs: got %v, want %v", elem.Attrs, want)
+	}
+}
+
 // TestCombinedSpecialTags tests multiple special tags together
 func TestCombinedSpecialTags(t *testing.T) {
 	type Advanced struct {
@@ -3682,3 +4009,4869 @@ func TestEmptyElementsWithDifferentTypes(t *testing.T) {
 		t.Errorf("PtrStr = %q, want empty string", *doc.PtrStr)
 	}
 }
+
+// TypedCustomField is a CustomField that coerces its value based on the type attribute
+type TypedCustomField struct {
+	Key      string `xml:"key,attr"`
+	Type     string `xml:"type,attr"`
+	Value    string `xml:",chardata"`
+	ValueInt int    `xml:"-"`
+}
+
+func (f *TypedCustomField) CoerceCharData(text string) error {
+	if f.Type != "number" {
+		return nil
+	}
+	i, err := strconv.Atoi(text)
+	if err != nil {
+		return fmt.Errorf("custom field %s: %w", f.Key, err)
+	}
+	f.ValueInt = i
+	return nil
+}
+
+// TestCharDataCoercer tests chardata coercion based on sibling attributes
+func TestCharDataCoercer(t *testing.T) {
+	type Metadata struct {
+		XMLName      xml.Name           `xml:"metadata"`
+		CustomFields []TypedCustomField `xml:"custom-field"`
+	}
+
+	xmlData := []byte(`<metadata>
+		<custom-field key="department" type="string">Engineering</custom-field>
+		<custom-field key="employee-id" type="number"> 12345 </custom-field>
+	</metadata>`)
+
+	var meta Metadata
+	err := xmlctx.Unmarshal(xmlData, &meta, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(meta.CustomFields) != 2 {
+		t.Fatalf("CustomFields: got %d, want 2", len(meta.CustomFields))
+	}
+	if meta.CustomFields[0].Value != "Engineering" {
+		t.Errorf("CustomFields[0].Value: got %s, want Engineering", meta.CustomFields[0].Value)
+	}
+	if meta.CustomFields[0].ValueInt != 0 {
+		t.Errorf("CustomFields[0].ValueInt: got %d, want 0", meta.CustomFields[0].ValueInt)
+	}
+	if meta.CustomFields[1].ValueInt != 12345 {
+		t.Errorf("CustomFields[1].ValueInt: got %d, want 12345", meta.CustomFields[1].ValueInt)
+	}
+
+	t.Run("invalid-number", func(t *testing.T) {
+		xmlData := []byte(`<metadata><custom-field key="age" type="number">abc</custom-field></metadata>`)
+		var meta Metadata
+		err := xmlctx.Unmarshal(xmlData, &meta, xmlctx.WithNamespaces(map[string]string{}))
+		if err == nil {
+			t.Error("Expected error for invalid number, got nil")
+		}
+	})
+}
+
+// TestRootSliceContainer tests decoding the root's children directly into a slice
+func TestRootSliceContainer(t *testing.T) {
+	type Member struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	xmlData := []byte(`<users>
+		<user id="1"><name>Alice</name></user>
+		<user id="2"><name>Bob</name></user>
+		<user id="3"><name>Carol</name></user>
+	</users>`)
+
+	var users []Member
+	err := xmlctx.Unmarshal(xmlData, &users, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(users) != 3 {
+		t.Fatalf("users: got %d, want 3", len(users))
+	}
+	want := []Member{{"1", "Alice"}, {"2", "Bob"}, {"3", "Carol"}}
+	for i, u := range users {
+		if u != want[i] {
+			t.Errorf("users[%d]: got %+v, want %+v", i, u, want[i])
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		var users []Member
+		err := xmlctx.Unmarshal([]byte(`<users/>`), &users, xmlctx.WithNamespaces(map[string]string{}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if len(users) != 0 {
+			t.Errorf("users: got %d, want 0", len(users))
+		}
+	})
+}
+
+// TestListAttributeWithTextUnmarshaler tests list attributes decoded into slices of custom types
+func TestListAttributeWithTextUnmarshaler(t *testing.T) {
+	type Element struct {
+		XMLName xml.Name            `xml:"element"`
+		IDs     []TextUnmarshalType `xml:"ids,attr"`
+		Names   []string            `xml:"names,attr"`
+	}
+
+	xmlData := []byte(`<element ids="1,2,3" names="a b  c"/>`)
+
+	var elem Element
+	err := xmlctx.Unmarshal(xmlData, &elem, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(elem.IDs) != 3 {
+		t.Fatalf("IDs: got %d items, want 3", len(elem.IDs))
+	}
+	for i, want := range []int{10, 20, 30} {
+		if elem.IDs[i].Value != want {
+			t.Errorf("IDs[%d].Value: got %d, want %d", i, elem.IDs[i].Value, want)
+		}
+	}
+	if strings.Join(elem.Names, "|") != "a|b|c" {
+		t.Errorf("Names: got %v, want [a b c]", elem.Names)
+	}
+
+	t.Run("invalid-item", func(t *testing.T) {
+		var elem Element
+		err := xmlctx.Unmarshal([]byte(`<element ids="1,x,3"/>`), &elem, xmlctx.WithNamespaces(map[string]string{}))
+		if err == nil {
+			t.Error("Expected error for invalid list item, got nil")
+		}
+	})
+}
+
+// TestMalformedInputDoesNotHang tests that truncated or malformed XML returns an error promptly
+func TestMalformedInputDoesNotHang(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Name    string   `xml:"name"`
+		Count   int      `xml:"count"`
+		Enabled bool     `xml:"enabled"`
+		Items   []string `xml:"list>item"`
+		Inner   struct {
+			Raw string `xml:",innerxml"`
+		} `xml:"inner"`
+	}
+
+	tests := map[string]string{
+		"truncated-string":   `<doc><name>John`,
+		"truncated-int":      `<doc><count>4`,
+		"truncated-bool":     `<doc><enabled>tr`,
+		"truncated-path":     `<doc><list><item>a</item>`,
+		"truncated-innerxml": `<doc><inner><b>x`,
+		"mismatched-tags":    `<doc><name>John</count></doc>`,
+		"unterminated-tag":   `<doc><name`,
+		"invalid-entity":     `<doc><name>&bogus;</name></doc>`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan error, 1)
+			go func() {
+				var doc Doc
+				done <- xmlctx.Unmarshal([]byte(data), &doc, xmlctx.WithNamespaces(map[string]string{}))
+			}()
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("Expected error for malformed input, got nil")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Decoding malformed input did not return")
+			}
+		})
+	}
+}
+
+// TestTextField tests collecting all descendant text with the ,text tag
+func TestTextField(t *testing.T) {
+	type Para struct {
+		XMLName xml.Name `xml:"p"`
+		Text    string   `xml:",text"`
+		Bold    string   `xml:"b"`
+	}
+
+	xmlData := []byte(`<p>Hello <b>world</b>!</p>`)
+	var para Para
+	err := xmlctx.Unmarshal(xmlData, &para, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if para.Text != "Hello world!" {
+		t.Errorf("Text: got %q, want %q", para.Text, "Hello world!")
+	}
+	// Child elements are still decoded into their fields
+	if para.Bold != "world" {
+		t.Errorf("Bold: got %q, want %q", para.Bold, "world")
+	}
+
+	t.Run("nested-namespaces", func(t *testing.T) {
+		type Doc struct {
+			XMLName xml.Name `xml:"doc"`
+			Text    string   `xml:",text"`
+			Title   string   `xml:"ns1:title"`
+		}
+
+		xmlData := []byte(`<doc xmlns:a="http://example.com/ns1"><a:title>Title</a:title> and <i>more <u>text</u></i></doc>`)
+		var doc Doc
+		err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{
+			"ns1": "http://example.com/ns1",
+		}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.Text != "Title and more text" {
+			t.Errorf("Text: got %q, want %q", doc.Text, "Title and more text")
+		}
+		if doc.Title != "Title" {
+			t.Errorf("Title: got %q, want %q", doc.Title, "Title")
+		}
+	})
+}
+
+// TestWithNamespaceMaps tests merging several partial namespace maps
+func TestWithNamespaceMaps(t *testing.T) {
+	core := map[string]string{"": DefaultNS}
+	profile := map[string]string{"ns1": "http://example.com/wrong"}
+	address := map[string]string{"ns1": NS1URL, "ns2": NS2URL}
+
+	for _, file := range []string{"01_explicit_prefixes.xml", "02_different_prefix_names.xml"} {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+
+			var user User
+			err = xmlctx.Unmarshal(data, &user, xmlctx.WithNamespaceMaps(core, profile, address))
+			if err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			verifyUser(t, user)
+		})
+	}
+
+	// The provided maps must not be modified by merging
+	if len(core) != 1 || len(profile) != 1 || profile["ns1"] != "http://example.com/wrong" {
+		t.Error("WithNamespaceMaps modified its input maps")
+	}
+
+	t.Run("with-namespace", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+
+		var user User
+		err = xmlctx.Unmarshal(data, &user,
+			xmlctx.WithNamespaceMaps(core, profile),
+			xmlctx.WithNamespace("ns1", NS1URL),
+			xmlctx.WithNamespace("ns2", NS2URL),
+		)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		verifyUser(t, user)
+	})
+
+	t.Run("replaced-by-with-namespaces", func(t *testing.T) {
+		xmlData := []byte(`<doc xmlns:a="http://example.com/a"><a:name>John</a:name></doc>`)
+		type Doc struct {
+			Name string `xml:"a:name"`
+		}
+
+		var doc Doc
+		err := xmlctx.Unmarshal(xmlData, &doc,
+			xmlctx.WithNamespace("a", "http://example.com/a"),
+			xmlctx.WithNamespaces(map[string]string{}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.Name != "" {
+			t.Errorf("Name: got %q, want empty after WithNamespaces replaced the mappings", doc.Name)
+		}
+	})
+}
+
+// TestDefaultAndPrefixedCrossMatching tests that elements and tags match by
+// namespace URI whether the namespace is the default one or prefixed, in
+// either the document or the namespace map
+func TestDefaultAndPrefixedCrossMatching(t *testing.T) {
+	t.Run("default-doc/prefixed-tag", func(t *testing.T) {
+		type Person struct {
+			XMLName xml.Name `xml:"x:person"`
+			Name    string   `xml:"x:name"`
+			Lang    string   `xml:"lang,attr"`
+		}
+		var person Person
+		err := xmlctx.Unmarshal([]byte(`<person xmlns="urn:x" lang="en"><name>Ann</name></person>`), &person,
+			xmlctx.WithNamespaces(map[string]string{"x": "urn:x"}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if person.Name != "Ann" || person.Lang != "en" {
+			t.Errorf("got Name %q and Lang %q, want Ann and en", person.Name, person.Lang)
+		}
+	})
+
+	t.Run("prefixed-doc/default-tag", func(t *testing.T) {
+		type Person struct {
+			XMLName xml.Name `xml:"person"`
+			Name    string   `xml:"name"`
+			Lang    string   `xml:"lang,attr"`
+		}
+		var person Person
+		err := xmlctx.Unmarshal([]byte(`<p:person xmlns:p="urn:x" lang="en"><p:name>Ann</p:name></p:person>`), &person,
+			xmlctx.WithNamespaces(map[string]string{"": "urn:x"}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if person.Name != "Ann" || person.Lang != "en" {
+			t.Errorf("got Name %q and Lang %q, want Ann and en", person.Name, person.Lang)
+		}
+	})
+}
+
+// TestNamespaceSources tests seeding the namespace map from the document and
+// reporting where each mapping came from
+func TestNamespaceSources(t *testing.T) {
+	type Invoice struct {
+		XMLName xml.Name `xml:"invoice"`
+		ID      string   `xml:"id"`
+		Total   int      `xml:"inv:total"`
+		Party   string   `xml:"pty:name"`
+	}
+
+	configured := map[string]string{"": "urn:invoice", "pty": "urn:party"}
+	xmlData := `<invoice xmlns="urn:invoice" xmlns:inv="urn:invoice" xmlns:pty="urn:other" xmlns:p="urn:party">
+		<id>A1</id><inv:total>100</inv:total><p:name>Ann</p:name>
+	</invoice>
+	<invoice xmlns="urn:invoice" xmlns:tax="urn:tax"><id>A2</id></invoice>`
+
+	dec := xmlctx.NewDecoder(strings.NewReader(xmlData), xmlctx.WithNamespaces(configured), xmlctx.WithNamespacesFromDocument())
+	want := map[string]string{"": xmlctx.NamespaceConfigured, "pty": xmlctx.NamespaceConfigured}
+	if got := dec.NamespaceSources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NamespaceSources before Decode: got %v, want %v", got, want)
+	}
+
+	var inv Invoice
+	if err := dec.Decode(&inv); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if inv.ID != "A1" || inv.Total != 100 || inv.Party != "Ann" {
+		t.Errorf("got %+v, want A1 with total 100 and party Ann", inv)
+	}
+	want = map[string]string{
+		"":    xmlctx.NamespaceConfigured,
+		"pty": xmlctx.NamespaceConfigured,
+		"inv": xmlctx.NamespaceFromDocument,
+		"p":   xmlctx.NamespaceFromDocument,
+	}
+	if got := dec.NamespaceSources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NamespaceSources: got %v, want %v", got, want)
+	}
+
+	// Mappings seeded from an earlier document are replaced
+	if err := dec.Decode(&inv); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	want = map[string]string{
+		"":    xmlctx.NamespaceConfigured,
+		"pty": xmlctx.NamespaceConfigured,
+		"tax": xmlctx.NamespaceFromDocument,
+	}
+	if got := dec.NamespaceSources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("NamespaceSources after second Decode: got %v, want %v", got, want)
+	}
+	// The configured map is never modified
+	if len(configured) != 2 {
+		t.Errorf("configured map was modified: %v", configured)
+	}
+}
+
+// TestCapacityHint tests pre-sizing slices from a count attribute
+func TestCapacityHint(t *testing.T) {
+	type Items struct {
+		XMLName xml.Name `xml:"items"`
+		Count   int      `xml:"count,attr"`
+		Items   []int    `xml:"item,cap=count"`
+	}
+	type ItemsNoHint struct {
+		XMLName xml.Name `xml:"items"`
+		Count   int      `xml:"count,attr"`
+		Items   []int    `xml:"item"`
+	}
+
+	var b strings.Builder
+	b.WriteString(`<items count="500">`)
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&b, "<item>%d</item>", i)
+	}
+	b.WriteString(`</items>`)
+	xmlData := []byte(b.String())
+
+	var items Items
+	if err := xmlctx.Unmarshal(xmlData, &items, xmlctx.WithNamespaces(map[string]string{})); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(items.Items) != 500 {
+		t.Fatalf("Items: got %d, want 500", len(items.Items))
+	}
+	if cap(items.Items) != 500 {
+		t.Errorf("Items capacity: got %d, want 500", cap(items.Items))
+	}
+	if items.Items[499] != 499 {
+		t.Errorf("Items[499]: got %d, want 499", items.Items[499])
+	}
+
+	withHint := testing.AllocsPerRun(10, func() {
+		var items Items
+		_ = xmlctx.Unmarshal(xmlData, &items, xmlctx.WithNamespaces(map[string]string{}))
+	})
+	withoutHint := testing.AllocsPerRun(10, func() {
+		var items ItemsNoHint
+		_ = xmlctx.Unmarshal(xmlData, &items, xmlctx.WithNamespaces(map[string]string{}))
+	})
+	if withHint >= withoutHint {
+		t.Errorf("Allocations with hint (%v) should be fewer than without (%v)", withHint, withoutHint)
+	}
+
+	t.Run("invalid-count", func(t *testing.T) {
+		for _, count := range []string{"-1", "many"} {
+			var items Items
+			err := xmlctx.Unmarshal([]byte(`<items count="`+count+`"><item>1</item></items>`), &items, xmlctx.WithNamespaces(map[string]string{}))
+			if err == nil {
+				t.Errorf("Expected error for count=%q, got nil", count)
+			}
+		}
+	})
+
+	t.Run("oversized-count", func(t *testing.T) {
+		var items Items
+		err := xmlctx.Unmarshal([]byte(`<items count="999999999999"><item>1</item></items>`), &items, xmlctx.WithNamespaces(map[string]string{}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if cap(items.Items) > 1<<16 {
+			t.Errorf("Items capacity: got %d, want at most %d", cap(items.Items), 1<<16)
+		}
+	})
+}
+
+// PooledUser is a reusable struct implementing Resettable
+type PooledUser struct {
+	XMLName xml.Name `xml:"user"`
+	ID      string   `xml:"id,attr"`
+	Name    string   `xml:"name"`
+	Email   string   `xml:"email"`
+	Tags    []string `xml:"tag"`
+	resets  int
+}
+
+func (u *PooledUser) Reset() {
+	*u = PooledUser{resets: u.resets + 1}
+}
+
+// TestResettable tests that reused structs are reset before decoding
+func TestResettable(t *testing.T) {
+	pooled := &PooledUser{
+		ID:    "stale-id",
+		Name:  "Stale Name",
+		Email: "stale@example.com",
+		Tags:  []string{"stale"},
+	}
+
+	xmlData := []byte(`<user id="user-2"><name>Jane</name><tag>new</tag></user>`)
+	err := xmlctx.Unmarshal(xmlData, pooled, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if pooled.resets != 1 {
+		t.Errorf("resets: got %d, want 1", pooled.resets)
+	}
+	if pooled.ID != "user-2" {
+		t.Errorf("ID: got %s, want user-2", pooled.ID)
+	}
+	if pooled.Name != "Jane" {
+		t.Errorf("Name: got %s, want Jane", pooled.Name)
+	}
+	if pooled.Email != "" {
+		t.Errorf("Email: got %s, want empty (absent from document)", pooled.Email)
+	}
+	if len(pooled.Tags) != 1 || pooled.Tags[0] != "new" {
+		t.Errorf("Tags: got %v, want [new]", pooled.Tags)
+	}
+}
+
+// TestStrictPathThroughScalar tests that strict mode reports a path through a text-only element
+func TestStrictPathThroughScalar(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		ID      string   `xml:"a>b"`
+	}
+
+	xmlData := []byte(`<doc><a>just text</a></doc>`)
+
+	t.Run("lenient", func(t *testing.T) {
+		var doc Doc
+		err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.ID != "" {
+			t.Errorf("ID: got %q, want empty", doc.ID)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		var doc Doc
+		err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}), xmlctx.WithStrict())
+		if err == nil {
+			t.Fatal("Expected error for path through text-only element, got nil")
+		}
+		if !strings.Contains(err.Error(), "<a> has text content but no <b> child") {
+			t.Errorf("Unexpected error message: %v", err)
+		}
+	})
+
+	t.Run("strict-valid", func(t *testing.T) {
+		var doc Doc
+		err := xmlctx.Unmarshal([]byte(`<doc><a><b>42</b></a></doc>`), &doc, xmlctx.WithNamespaces(map[string]string{}), xmlctx.WithStrict())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.ID != "42" {
+			t.Errorf("ID: got %q, want 42", doc.ID)
+		}
+	})
+}
+
+// TestParse tests the generic Parse entry point
+func TestParse(t *testing.T) {
+	data, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	opts := xmlctx.WithNamespaces(map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+		"ns2": NS2URL,
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		user, err := xmlctx.Parse[User](data, opts)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		verifyUser(t, user)
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		user, err := xmlctx.Parse[*User](data, opts)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if user == nil {
+			t.Fatal("user should not be nil")
+		}
+		verifyUser(t, *user)
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		n, err := xmlctx.Parse[int]([]byte(`<count> 42 </count>`))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if n != 42 {
+			t.Errorf("n: got %d, want 42", n)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		user, err := xmlctx.Parse[*User](nil, opts)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if user != nil {
+			t.Errorf("user: got %+v, want nil", user)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		n, err := xmlctx.Parse[int]([]byte(`<count>abc</count>`))
+		if err == nil {
+			t.Error("Expected error for invalid integer, got nil")
+		}
+		if n != 0 {
+			t.Errorf("n: got %d, want zero value on error", n)
+		}
+	})
+}
+
+// TestAttrFieldNameFallback tests that ",attr" tags match the Go field name
+func TestAttrFieldNameFallback(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Version string   `xml:",attr"`
+		Count   int      `xml:",attr"`
+	}
+
+	xmlData := []byte(`<doc Version="1.0" Count="3" version="ignored"></doc>`)
+	var doc Doc
+	err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if doc.Version != "1.0" {
+		t.Errorf("Version: got %s, want 1.0", doc.Version)
+	}
+	if doc.Count != 3 {
+		t.Errorf("Count: got %d, want 3", doc.Count)
+	}
+}
+
+// TestElementFieldNameFallback tests that unnamed element tags match the Go field name
+func TestElementFieldNameFallback(t *testing.T) {
+	type Doc struct {
+		XMLName  xml.Name `xml:"doc"`
+		Name     string   `xml:",omitempty"`
+		Email    string   `xml:""`
+		Untagged string
+		Text     string `xml:",chardata"`
+	}
+
+	xmlData := []byte(`<doc>text<Name>John</Name><Email>john@example.com</Email><Untagged>skipped</Untagged><Text>skipped</Text></doc>`)
+	var doc Doc
+	err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if doc.Name != "John" {
+		t.Errorf("Name: got %q, want John", doc.Name)
+	}
+	if doc.Email != "john@example.com" {
+		t.Errorf("Email: got %q, want john@example.com", doc.Email)
+	}
+	if doc.Untagged != "" {
+		t.Errorf("Untagged: got %q, want empty", doc.Untagged)
+	}
+	// Special fields are never matched by field name
+	if doc.Text != "text" {
+		t.Errorf("Text: got %q, want text", doc.Text)
+	}
+}
+
+// TestBoolNumericCoercion tests decoding boolean literals into numeric fields
+func TestBoolNumericCoercion(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Active  uint8    `xml:"active,attr"`
+		Flag    int      `xml:"flag"`
+		Other   uint     `xml:"other"`
+	}
+
+	xmlData := []byte(`<doc active="false"><flag>true</flag><other>false</other></doc>`)
+
+	t.Run("default", func(t *testing.T) {
+		var doc Doc
+		err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}))
+		if err == nil {
+			t.Error("Expected error for boolean in numeric field, got nil")
+		}
+	})
+
+	t.Run("coercion", func(t *testing.T) {
+		doc := Doc{Active: 5, Other: 5}
+		err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{}), xmlctx.WithBoolNumericCoercion())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.Flag != 1 {
+			t.Errorf("Flag: got %d, want 1", doc.Flag)
+		}
+		if doc.Other != 0 {
+			t.Errorf("Other: got %d, want 0", doc.Other)
+		}
+		if doc.Active != 0 {
+			t.Errorf("Active: got %d, want 0", doc.Active)
+		}
+	})
+}
+
+// attrDecoder is shared by custom attribute unmarshalers to reuse xmlctx parsing
+var attrDecoder = xmlctx.NewDecoder(strings.NewReader(""), xmlctx.WithBoolNumericCoercion())
+
+// PortRange parses "from-to" attributes using the decoder's value parsing
+type PortRange struct {
+	From uint16
+	To   uint16
+}
+
+func (p *PortRange) UnmarshalXMLAttr(attr xml.Attr) error {
+	from, to, ok := strings.Cut(attr.Value, "-")
+	if !ok {
+		to = from
+	}
+	if err := attrDecoder.SetAttrValue(&p.From, from); err != nil {
+		return err
+	}
+	return attrDecoder.SetAttrValue(&p.To, to)
+}
+
+// TestSetAttrValue tests reusing the decoder's attribute parsing from custom code
+func TestSetAttrValue(t *testing.T) {
+	type Rule struct {
+		XMLName xml.Name  `xml:"rule"`
+		Ports   PortRange `xml:"ports,attr"`
+		Single  PortRange `xml:"single,attr"`
+	}
+
+	var rule Rule
+	err := xmlctx.Unmarshal([]byte(`<rule ports="8000-8080" single="443"/>`), &rule)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if rule.Ports != (PortRange{8000, 8080}) {
+		t.Errorf("Ports: got %+v, want {8000 8080}", rule.Ports)
+	}
+	if rule.Single != (PortRange{443, 443}) {
+		t.Errorf("Single: got %+v, want {443 443}", rule.Single)
+	}
+
+	t.Run("invalid-value", func(t *testing.T) {
+		var rule Rule
+		err := xmlctx.Unmarshal([]byte(`<rule ports="80-http"/>`), &rule)
+		if err == nil {
+			t.Error("Expected error for invalid port, got nil")
+		}
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		var enabled int
+		if err := attrDecoder.SetAttrValue(&enabled, "true"); err != nil {
+			t.Fatalf("SetAttrValue failed: %v", err)
+		}
+		if enabled != 1 {
+			t.Errorf("enabled: got %d, want 1", enabled)
+		}
+		if err := attrDecoder.SetAttrValue(enabled, "1"); err == nil {
+			t.Error("Expected error for non-pointer target, got nil")
+		}
+	})
+}
+
+// TestPrefixedElementsMatchUnprefixedTags tests that prefixed elements match unprefixed
+// tags when the prefix resolves to the configured default namespace URI
+func TestPrefixedElementsMatchUnprefixedTags(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Name    string   `xml:"name"`
+		Email   string   `xml:"email"`
+		Bio     string   `xml:"ns2:bio"`
+	}
+	opts := xmlctx.WithNamespaces(map[string]string{
+		"":    NS1URL,
+		"ns2": NS2URL,
+	})
+
+	tests := []struct {
+		name    string
+		xmlData string
+	}{
+		{
+			name:    "all-prefixed",
+			xmlData: `<p:doc xmlns:p="` + NS1URL + `" xmlns:q="` + NS2URL + `"><p:name>John</p:name><p:email>john@example.com</p:email><q:bio>Hi</q:bio></p:doc>`,
+		},
+		{
+			name:    "mixed-prefixed-and-default",
+			xmlData: `<doc xmlns="` + NS1URL + `" xmlns:ns1="` + NS1URL + `"><ns1:name>John</ns1:name><email>john@example.com</email><bio xmlns="` + NS2URL + `">Hi</bio></doc>`,
+		},
+		{
+			name:    "prefix-declared-on-element",
+			xmlData: `<doc xmlns="` + NS1URL + `"><x:name xmlns:x="` + NS1URL + `">John</x:name><x:email xmlns:x="` + NS1URL + `">john@example.com</x:email><x:bio xmlns:x="` + NS2URL + `">Hi</x:bio></doc>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc Doc
+			if err := xmlctx.Unmarshal([]byte(tt.xmlData), &doc, opts); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if doc.Name != "John" {
+				t.Errorf("Name: got %q, want John", doc.Name)
+			}
+			if doc.Email != "john@example.com" {
+				t.Errorf("Email: got %q, want john@example.com", doc.Email)
+			}
+			if doc.Bio != "Hi" {
+				t.Errorf("Bio: got %q, want Hi", doc.Bio)
+			}
+		})
+	}
+
+	t.Run("prefix-resolving-elsewhere", func(t *testing.T) {
+		xmlData := `<doc xmlns="` + NS1URL + `" xmlns:q="` + NS2URL + `"><q:name>John</q:name></doc>`
+		var doc Doc
+		if err := xmlctx.Unmarshal([]byte(xmlData), &doc, opts); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.Name != "" {
+			t.Errorf("Name: got %q, want empty for element outside the default namespace", doc.Name)
+		}
+	})
+}
+
+// TestDebugTrace tests that decode decisions are written to the trace writer
+func TestDebugTrace(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Name    string   `xml:"name"`
+		Bio     string   `xml:"ns1:bio"`
+		City    string   `xml:"addr>city"`
+	}
+
+	xmlData := []byte(`<doc xmlns:p="http://example.com/other">
+		<name>John</name>
+		<p:bio>Hi</p:bio>
+		<unknown>x</unknown>
+		<addr><city>SF</city></addr>
+	</doc>`)
+
+	var trace strings.Builder
+	var doc Doc
+	err := xmlctx.Unmarshal(xmlData, &doc,
+		xmlctx.WithNamespaces(map[string]string{"ns1": NS1URL}),
+		xmlctx.WithDebugTrace(&trace),
+	)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	output := trace.String()
+	for _, want := range []string{
+		`xmlctx: element name: matched field tag "name"`,
+		`xmlctx: tag "ns1:bio": element namespace "http://example.com/other" does not match "` + NS1URL + `"`,
+		`xmlctx: element {http://example.com/other}bio: no matching field in xmlctx_test.Doc, skipped`,
+		`xmlctx: element unknown: no matching field in xmlctx_test.Doc, skipped`,
+		`xmlctx: element addr: descending into path field "addr>city"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Trace missing %q\nGot:\n%s", want, output)
+		}
+	}
+
+	if doc.Name != "John" || doc.City != "SF" {
+		t.Errorf("Decoded values changed by tracing: %+v", doc)
+	}
+}
+
+// TestElementAttrAccumulation tests collecting an attribute across repeated elements
+func TestElementAttrAccumulation(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		IDs     []string `xml:"tag,attr=id"`
+		Scores  []int    `xml:"ns1:score,attr=value"`
+		First   string   `xml:"first,attr=ref"`
+	}
+
+	xmlData := []byte(`<doc xmlns:s="` + NS1URL + `">
+		<tag id="x">one</tag>
+		<tag id="y"/>
+		<s:score value="10"/>
+		<tag id="z"><nested/></tag>
+		<tag>no id</tag>
+		<s:score value="20"/>
+		<first ref="r1"/>
+	</doc>`)
+
+	var doc Doc
+	err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{"ns1": NS1URL}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if strings.Join(doc.IDs, ",") != "x,y,z" {
+		t.Errorf("IDs: got %v, want [x y z]", doc.IDs)
+	}
+	if len(doc.Scores) != 2 || doc.Scores[0] != 10 || doc.Scores[1] != 20 {
+		t.Errorf("Scores: got %v, want [10 20]", doc.Scores)
+	}
+	if doc.First != "r1" {
+		t.Errorf("First: got %q, want r1", doc.First)
+	}
+}
+
+// TestAttrOrCharData tests fields taking an attribute or, when absent, the element text
+func TestAttrOrCharData(t *testing.T) {
+	type Price struct {
+		XMLName  xml.Name `xml:"price"`
+		Amount   int      `xml:"amount,attr,orchardata"`
+		Currency string   `xml:"currency,attr"`
+	}
+
+	tests := []struct {
+		name    string
+		xmlData string
+		want    Price
+	}{
+		{"attribute", `<price amount="1999" currency="USD"/>`, Price{Amount: 1999, Currency: "USD"}},
+		{"chardata", `<price currency="EUR"> 2500 </price>`, Price{Amount: 2500, Currency: "EUR"}},
+		{"attribute-wins", `<price amount="10">20</price>`, Price{Amount: 10}},
+		{"neither", `<price currency="GBP"/>`, Price{Currency: "GBP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var price Price
+			if err := xmlctx.Unmarshal([]byte(tt.xmlData), &price); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if price.Amount != tt.want.Amount || price.Currency != tt.want.Currency {
+				t.Errorf("got %+v, want %+v", price, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid-chardata", func(t *testing.T) {
+		var price Price
+		if err := xmlctx.Unmarshal([]byte(`<price>abc</price>`), &price); err == nil {
+			t.Error("Expected error for invalid chardata amount, got nil")
+		}
+	})
+}
+
+// TestMaxTextLength tests limiting the size of accumulated element text
+func TestMaxTextLength(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Name    string   `xml:"name"`
+		Note    struct {
+			Text string `xml:",chardata"`
+		} `xml:"note"`
+		Raw struct {
+			XML string `xml:",innerxml"`
+		} `xml:"raw"`
+	}
+
+	limit := xmlctx.WithMaxTextLength(10)
+
+	tests := []struct {
+		name    string
+		xmlData string
+		wantErr bool
+	}{
+		{"string-at-limit", `<doc><name>0123456789</name></doc>`, false},
+		{"string-over-limit", `<doc><name>0123456789A</name></doc>`, true},
+		{"chardata-at-limit", `<doc><note>01234<!-- c -->56789</note></doc>`, false},
+		{"chardata-over-limit", `<doc><note>01234<x/>567890</note></doc>`, true},
+		{"innerxml-at-limit", `<doc><raw><b>123</b></raw></doc>`, false},
+		{"innerxml-over-limit", `<doc><raw><b>1234</b></raw></doc>`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc Doc
+			err := xmlctx.Unmarshal([]byte(tt.xmlData), &doc, limit)
+			if tt.wantErr && err == nil {
+				t.Error("Expected error for text over the limit, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		var doc Doc
+		name := strings.Repeat("x", 100000)
+		if err := xmlctx.Unmarshal([]byte(`<doc><name>`+name+`</name></doc>`), &doc); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.Name != name {
+			t.Errorf("Name: got %d bytes, want %d", len(doc.Name), len(name))
+		}
+	})
+}
+
+// TestLenientNamespaces tests the relaxations enabled by WithLenientNamespaces
+func TestLenientNamespaces(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Name    string   `xml:"name"`
+		Bio     string   `xml:"ns1:bio"`
+		ID      string   `xml:"id,attr"`
+		Type    string   `xml:"ns1:type,attr"`
+	}
+	withDefault := map[string]string{"": DefaultNS, "ns1": NS1URL}
+	withoutDefault := map[string]string{"ns1": NS1URL}
+
+	tests := []struct {
+		name       string
+		namespaces map[string]string
+		xmlData    string
+		strict     Doc
+		lenient    Doc
+	}{
+		{
+			name:       "unqualified-element-with-default",
+			namespaces: withDefault,
+			xmlData:    `<doc><name>John</name></doc>`,
+			strict:     Doc{},
+			lenient:    Doc{Name: "John"},
+		},
+		{
+			name:       "default-ns-element-with-default",
+			namespaces: withDefault,
+			xmlData:    `<doc xmlns="` + DefaultNS + `"><name>John</name></doc>`,
+			strict:     Doc{Name: "John"},
+			lenient:    Doc{Name: "John"},
+		},
+		{
+			name:       "other-ns-element-with-default",
+			namespaces: withDefault,
+			xmlData:    `<doc xmlns:o="http://example.com/other"><o:name>John</o:name></doc>`,
+			strict:     Doc{},
+			lenient:    Doc{},
+		},
+		{
+			name:       "default-ns-element-without-default",
+			namespaces: withoutDefault,
+			xmlData:    `<doc xmlns="` + DefaultNS + `"><name>John</name></doc>`,
+			strict:     Doc{},
+			lenient:    Doc{Name: "John"},
+		},
+		{
+			name:       "unqualified-element-for-prefixed-tag",
+			namespaces: withDefault,
+			xmlData:    `<doc><bio>Hi</bio></doc>`,
+			strict:     Doc{},
+			lenient:    Doc{Bio: "Hi"},
+		},
+		{
+			name:       "wrong-ns-element-for-prefixed-tag",
+			namespaces: withDefault,
+			xmlData:    `<doc xmlns:o="http://example.com/other"><o:bio>Hi</o:bio></doc>`,
+			strict:     Doc{},
+			lenient:    Doc{},
+		},
+		{
+			name:       "unqualified-attr-for-prefixed-tag",
+			namespaces: withDefault,
+			xmlData:    `<doc type="admin"/>`,
+			strict:     Doc{},
+			lenient:    Doc{Type: "admin"},
+		},
+		{
+			name:       "default-ns-attr-for-plain-tag",
+			namespaces: withDefault,
+			xmlData:    `<doc xmlns:d="` + DefaultNS + `" d:id="42"/>`,
+			strict:     Doc{ID: "42"},
+			lenient:    Doc{ID: "42"},
+		},
+		{
+			name:       "qualified-attr-for-prefixed-tag",
+			namespaces: withDefault,
+			xmlData:    `<doc xmlns:p="` + NS1URL + `" p:type="admin"/>`,
+			strict:     Doc{Type: "admin"},
+			lenient:    Doc{Type: "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var strict Doc
+			if err := xmlctx.Unmarshal([]byte(tt.xmlData), &strict, xmlctx.WithNamespaces(tt.namespaces)); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			strict.XMLName = xml.Name{}
+			if strict != tt.strict {
+				t.Errorf("strict: got %+v, want %+v", strict, tt.strict)
+			}
+
+			var lenient Doc
+			if err := xmlctx.Unmarshal([]byte(tt.xmlData), &lenient, xmlctx.WithNamespaces(tt.namespaces), xmlctx.WithLenientNamespaces()); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			lenient.XMLName = xml.Name{}
+			if lenient != tt.lenient {
+				t.Errorf("lenient: got %+v, want %+v", lenient, tt.lenient)
+			}
+		})
+	}
+}
+
+// TestUnmarshalPrefix tests decoding a document and returning the trailing bytes
+func TestUnmarshalPrefix(t *testing.T) {
+	type Msg struct {
+		XMLName xml.Name `xml:"msg"`
+		ID      int      `xml:"id,attr"`
+		Body    string   `xml:"body"`
+	}
+
+	data := []byte(`<?xml version="1.0"?><msg id="1"><body>first</body></msg><msg id="2"><body>second</body></msg>` + "\x00\x01binary")
+
+	var first Msg
+	rest, err := xmlctx.UnmarshalPrefix(data, &first)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if first.ID != 1 || first.Body != "first" {
+		t.Errorf("first: got %+v", first)
+	}
+	wantRest := `<msg id="2"><body>second</body></msg>` + "\x00\x01binary"
+	if string(rest) != wantRest {
+		t.Fatalf("rest: got %q, want %q", rest, wantRest)
+	}
+
+	var second Msg
+	rest, err = xmlctx.UnmarshalPrefix(rest, &second)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if second.ID != 2 || second.Body != "second" {
+		t.Errorf("second: got %+v", second)
+	}
+	if string(rest) != "\x00\x01binary" {
+		t.Errorf("rest: got %q, want %q", rest, "\x00\x01binary")
+	}
+
+	t.Run("error", func(t *testing.T) {
+		var msg Msg
+		rest, err := xmlctx.UnmarshalPrefix([]byte(`<msg id="x"></msg>tail`), &msg)
+		if err == nil {
+			t.Error("Expected error for invalid id, got nil")
+		}
+		if rest != nil {
+			t.Errorf("rest: got %q, want nil on error", rest)
+		}
+	})
+}
+
+// TestSharedPathPrefixes tests several path fields sharing a common two-level prefix
+func TestSharedPathPrefixes(t *testing.T) {
+	type Invoice struct {
+		XMLName  xml.Name `xml:"invoice"`
+		ID       string   `xml:"ns1:header>ns1:trade>ns1:id"`
+		Issued   string   `xml:"ns1:header>ns1:trade>ns1:issued"`
+		Currency string   `xml:"ns1:header>ns1:trade>ns1:currency"`
+		Total    int      `xml:"ns1:header>ns1:trade>ns1:total"`
+		Note     string   `xml:"ns1:header>ns1:trade>ns1:note"`
+		Seller   string   `xml:"ns1:header>ns1:seller"`
+	}
+
+	xmlData := []byte(`<invoice xmlns:r="` + NS1URL + `">
+		<r:header>
+			<r:trade>
+				<r:note>Thanks</r:note>
+				<r:id>INV-1</r:id>
+				<r:ignored>x</r:ignored>
+				<r:issued>2024-01-15</r:issued>
+				<r:currency>EUR</r:currency>
+				<r:total>100</r:total>
+			</r:trade>
+			<r:seller>ACME</r:seller>
+		</r:header>
+	</invoice>`)
+
+	var inv Invoice
+	err := xmlctx.Unmarshal(xmlData, &inv, xmlctx.WithNamespaces(map[string]string{"ns1": NS1URL}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	want := Invoice{
+		XMLName:  xml.Name{Local: "invoice"},
+		ID:       "INV-1",
+		Issued:   "2024-01-15",
+		Currency: "EUR",
+		Total:    100,
+		Note:     "Thanks",
+		Seller:   "ACME",
+	}
+	if inv != want {
+		t.Errorf("got %+v, want %+v", inv, want)
+	}
+}
+
+// TestTypedMaps tests decoding child elements into maps with typed values
+func TestTypedMaps(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name             `xml:"doc"`
+		Labels  map[string]string    `xml:"labels"`
+		Counts  map[string]int       `xml:"counts"`
+		Dates   map[string]time.Time `xml:"dates"`
+	}
+
+	xmlData := []byte(`<doc>
+		<labels><env>prod</env><team>core</team></labels>
+		<counts><users>42</users><groups> 7 </groups></counts>
+		<dates><created>2024-01-15T10:30:00Z</created><updated>2024-01-19T14:20:00+02:00</updated></dates>
+	</doc>`)
+
+	var doc Doc
+	if err := xmlctx.Unmarshal(xmlData, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if doc.Labels["env"] != "prod" || doc.Labels["team"] != "core" {
+		t.Errorf("Labels: got %v", doc.Labels)
+	}
+	if len(doc.Counts) != 2 || doc.Counts["users"] != 42 || doc.Counts["groups"] != 7 {
+		t.Errorf("Counts: got %v, want map[groups:7 users:42]", doc.Counts)
+	}
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	if !doc.Dates["created"].Equal(created) {
+		t.Errorf("Dates[created]: got %v, want %v", doc.Dates["created"], created)
+	}
+	updated := time.Date(2024, 1, 19, 12, 20, 0, 0, time.UTC)
+	if !doc.Dates["updated"].Equal(updated) {
+		t.Errorf("Dates[updated]: got %v, want %v", doc.Dates["updated"], updated)
+	}
+
+	t.Run("invalid-value", func(t *testing.T) {
+		var doc Doc
+		err := xmlctx.Unmarshal([]byte(`<doc><counts><users>many</users></counts></doc>`), &doc)
+		if err == nil {
+			t.Fatal("Expected error for invalid map value, got nil")
+		}
+		if !strings.Contains(err.Error(), `map key "users"`) {
+			t.Errorf("Error should name the offending key, got: %v", err)
+		}
+	})
+}
+
+// TestMapOfSlices tests that repeated child elements accumulate in
+// slice-valued maps and overwrite earlier values in scalar-valued maps
+func TestMapOfSlices(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name            `xml:"doc"`
+		Tags    map[string][]string `xml:"tags"`
+		Last    map[string]string   `xml:"last"`
+	}
+
+	xmlData := []byte(`<doc>
+		<tags><tag>a</tag><owner>core</owner><tag>b</tag><tag>c</tag></tags>
+		<last><tag>a</tag><tag>b</tag></last>
+	</doc>`)
+
+	var doc Doc
+	if err := xmlctx.Unmarshal(xmlData, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	want := map[string][]string{"tag": {"a", "b", "c"}, "owner": {"core"}}
+	if !reflect.DeepEqual(doc.Tags, want) {
+		t.Errorf("Tags: got %v, want %v", doc.Tags, want)
+	}
+	if doc.Last["tag"] != "b" {
+		t.Errorf("Last[tag]: got %s, want b", doc.Last["tag"])
+	}
+}
+
+// TestLowercaseFieldNames tests matching unnamed fields by their lowercased
+// Go field name with WithLowercaseFieldNames
+func TestLowercaseFieldNames(t *testing.T) {
+	type Person struct {
+		XMLName xml.Name `xml:"person"`
+		ID      string   `xml:",attr"`
+		Name    string   `xml:",omitempty"`
+		Email   string   `xml:"Email"`
+	}
+
+	xmlData := []byte(`<person id="7"><name>Ann</name><email>ann@example.com</email></person>`)
+
+	var person Person
+	if err := xmlctx.Unmarshal(xmlData, &person, xmlctx.WithLowercaseFieldNames()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if person.ID != "7" {
+		t.Errorf("ID: got %s, want 7", person.ID)
+	}
+	if person.Name != "Ann" {
+		t.Errorf("Name: got %s, want Ann", person.Name)
+	}
+	// Names given in the tag are matched as written
+	if person.Email != "" {
+		t.Errorf("Email: got %s, want empty", person.Email)
+	}
+
+	// By default the field name is matched as-is
+	person = Person{}
+	if err := xmlctx.Unmarshal(xmlData, &person); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if person.Name != "" || person.ID != "" {
+		t.Errorf("got Name %q and ID %q, want both empty", person.Name, person.ID)
+	}
+}
+
+// TestTagOptionNames tests element names that contain tag option words and
+// tags that combine several options
+func TestTagOptionNames(t *testing.T) {
+	type Entry struct {
+		XMLName  xml.Name `xml:"entry"`
+		ID       string   `xml:"id,attr,omitempty"`
+		Lang     string   `xml:",attr"`
+		Attr     string   `xml:"attr"`
+		Comments string   `xml:"comments"`
+		CDataLog string   `xml:"cdataLog,omitempty"`
+		AnyThing string   `xml:"anything"`
+		Text     string   `xml:",chardata"`
+		Note     string   `xml:",comment"`
+	}
+
+	xmlData := []byte(`<entry id="e1" Lang="en">
+		<attr>element named attr</attr>
+		<comments>element named comments</comments>
+		<cdataLog>element named cdataLog</cdataLog>
+		<anything>element named anything</anything>
+		<!-- a real comment -->
+		body
+	</entry>`)
+
+	var entry Entry
+	if err := xmlctx.Unmarshal(xmlData, &entry); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if entry.ID != "e1" {
+		t.Errorf("ID: got %s, want e1", entry.ID)
+	}
+	if entry.Lang != "en" {
+		t.Errorf("Lang: got %s, want en", entry.Lang)
+	}
+	if entry.Attr != "element named attr" {
+		t.Errorf("Attr: got %s, want element named attr", entry.Attr)
+	}
+	if entry.Comments != "element named comments" {
+		t.Errorf("Comments: got %s, want element named comments", entry.Comments)
+	}
+	if entry.CDataLog != "element named cdataLog" {
+		t.Errorf("CDataLog: got %s, want element named cdataLog", entry.CDataLog)
+	}
+	if entry.AnyThing != "element named anything" {
+		t.Errorf("AnyThing: got %s, want element named anything", entry.AnyThing)
+	}
+	if entry.Text != "body" {
+		t.Errorf("Text: got %q, want body", entry.Text)
+	}
+	if entry.Note != "a real comment" {
+		t.Errorf("Note: got %q, want a real comment", entry.Note)
+	}
+}
+
+// TestWholeElementWithPathFields tests a direct field capturing a whole element
+// alongside path fields reading children of the same element
+func TestWholeElementWithPathFields(t *testing.T) {
+	type Country struct {
+		ID   string `xml:"id"`
+		Name string `xml:"name"`
+	}
+	type Zone struct {
+		Code string `xml:"code"`
+	}
+	type Product struct {
+		XMLName    xml.Name `xml:"product"`
+		Country    Country  `xml:"country"`
+		Origin     string   `xml:"country>id"`
+		OriginName string   `xml:"country>name"`
+		Zone       Zone     `xml:"region>zone"`
+		ZoneCode   string   `xml:"region>zone>code"`
+	}
+
+	xmlData := []byte(`<product>
+		<country>
+			<id>ES</id>
+			<name>Spain</name>
+		</country>
+		<region>
+			<zone>
+				<code>EU</code>
+			</zone>
+		</region>
+	</product>`)
+
+	var product Product
+	if err := xmlctx.Unmarshal(xmlData, &product); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if product.Country.ID != "ES" || product.Country.Name != "Spain" {
+		t.Errorf("Country: got %+v, want {ES Spain}", product.Country)
+	}
+	if product.Origin != "ES" {
+		t.Errorf("Origin: got %s, want ES", product.Origin)
+	}
+	if product.OriginName != "Spain" {
+		t.Errorf("OriginName: got %s, want Spain", product.OriginName)
+	}
+	// A path ending at an element shares it with paths continuing below it
+	if product.Zone.Code != "EU" {
+		t.Errorf("Zone.Code: got %s, want EU", product.Zone.Code)
+	}
+	if product.ZoneCode != "EU" {
+		t.Errorf("ZoneCode: got %s, want EU", product.ZoneCode)
+	}
+}
+
+// TestPointerToSliceOfPointers tests decoding repeated elements into *[]*T
+func TestPointerToSliceOfPointers(t *testing.T) {
+	type Item struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		Items   *[]*Item `xml:"item"`
+	}
+
+	t.Run("repeated elements", func(t *testing.T) {
+		xmlData := []byte(`<order>
+			<item id="1"><name>First</name></item>
+			<item id="2"><name>Second</name></item>
+			<item id="3"><name>Third</name></item>
+		</order>`)
+
+		var order Order
+		if err := xmlctx.Unmarshal(xmlData, &order); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+
+		if order.Items == nil {
+			t.Fatal("Items: got nil, want allocated slice")
+		}
+		items := *order.Items
+		if len(items) != 3 {
+			t.Fatalf("Items: got %d, want 3", len(items))
+		}
+		for i, item := range items {
+			if item == nil {
+				t.Fatalf("Items[%d]: got nil", i)
+			}
+			if want := strconv.Itoa(i + 1); item.ID != want {
+				t.Errorf("Items[%d].ID: got %s, want %s", i, item.ID, want)
+			}
+		}
+		if items[2].Name != "Third" {
+			t.Errorf("Items[2].Name: got %s, want Third", items[2].Name)
+		}
+	})
+
+	t.Run("no elements", func(t *testing.T) {
+		var order Order
+		if err := xmlctx.Unmarshal([]byte(`<order></order>`), &order); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if order.Items != nil {
+			t.Errorf("Items: got %v, want nil", *order.Items)
+		}
+	})
+}
+
+// TestRequireRootNamespace tests failing when the root element's namespace is not configured
+func TestRequireRootNamespace(t *testing.T) {
+	namespaces := xmlctx.WithNamespaces(map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+		"ns2": NS2URL,
+	})
+
+	t.Run("matching root namespace", func(t *testing.T) {
+		data, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		var user User
+		if err := xmlctx.Unmarshal(data, &user, namespaces, xmlctx.WithRequireRootNamespace()); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if user.Name != "John Doe" {
+			t.Errorf("Name: got %s, want John Doe", user.Name)
+		}
+	})
+
+	for _, file := range []string{
+		"testdata/invalid/07_wrong_default_namespace.xml",
+		"testdata/invalid/09_no_namespace_declarations.xml",
+	} {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+
+			// Without the option the mistake goes unnoticed
+			var user User
+			if err := xmlctx.Unmarshal(data, &user, namespaces); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+
+			err = xmlctx.Unmarshal(data, &user, namespaces, xmlctx.WithRequireRootNamespace())
+			if err == nil {
+				t.Fatal("Expected error for root namespace missing from the map, got nil")
+			}
+			if !strings.Contains(err.Error(), "root element user") {
+				t.Errorf("Error should name the root element, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("root without XMLName", func(t *testing.T) {
+		type Doc struct {
+			Name string `xml:"name"`
+		}
+		data := []byte(`<doc xmlns="http://example.com/other"><name>x</name></doc>`)
+		var doc Doc
+		err := xmlctx.Unmarshal(data, &doc, namespaces, xmlctx.WithRequireRootNamespace())
+		if err == nil || !strings.Contains(err.Error(), "is not in the namespace map") {
+			t.Errorf("Expected namespace map error, got: %v", err)
+		}
+		data = []byte(`<doc xmlns="http://example.com/schema/profile"><name>x</name></doc>`)
+		if err := xmlctx.Unmarshal(data, &doc, namespaces, xmlctx.WithRequireRootNamespace()); err != nil {
+			t.Errorf("Root in a configured namespace: got error %v", err)
+		}
+	})
+}
+
+// TestCharacterReferencesInAttributes tests that numeric character references in
+// attribute values are expanded before numeric parsing
+func TestCharacterReferencesInAttributes(t *testing.T) {
+	type Stock struct {
+		XMLName  xml.Name `xml:"stock"`
+		Count    int      `xml:"count,attr"`
+		Reserved uint     `xml:"reserved,attr"`
+		Limit    *int     `xml:"limit,attr"`
+		Code     string   `xml:"code,attr"`
+	}
+
+	xmlData := []byte(`<stock count="&#52;&#50;" reserved="&#x37;" limit="&#32;1&#48;&#9;" code="&#65;&#66;"></stock>`)
+
+	var stock Stock
+	if err := xmlctx.Unmarshal(xmlData, &stock); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if stock.Count != 42 {
+		t.Errorf("Count: got %d, want 42", stock.Count)
+	}
+	if stock.Reserved != 7 {
+		t.Errorf("Reserved: got %d, want 7", stock.Reserved)
+	}
+	// Whitespace produced by references is trimmed before parsing
+	if stock.Limit == nil || *stock.Limit != 10 {
+		t.Errorf("Limit: got %v, want 10", stock.Limit)
+	}
+	if stock.Code != "AB" {
+		t.Errorf("Code: got %s, want AB", stock.Code)
+	}
+}
+
+// TestNamespaceWildcardField tests collecting every element of one namespace with a "prefix:*" tag
+func TestNamespaceWildcardField(t *testing.T) {
+	type Extensions struct {
+		XMLName xml.Name      `xml:"extensions"`
+		Source  string        `xml:"ns2:source"`
+		Fields  []CustomField `xml:"ns2:*"`
+		Note    string        `xml:"ns1:note"`
+	}
+
+	xmlData := []byte(`<extensions xmlns:ns1="http://example.com/schema/profile" xmlns:ns2="http://example.com/schema/address">
+		<ns2:color key="color" type="string">blue</ns2:color>
+		<ns1:note>profile note</ns1:note>
+		<ns1:size key="size" type="int">10</ns1:size>
+		<ns2:source>import</ns2:source>
+		<ns2:weight key="weight" type="int">3</ns2:weight>
+	</extensions>`)
+
+	var ext Extensions
+	err := xmlctx.Unmarshal(xmlData, &ext, xmlctx.WithNamespaces(map[string]string{
+		"ns1": NS1URL,
+		"ns2": NS2URL,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	// ns1 elements are ignored, and the exact ns2:source tag wins over the wildcard
+	if len(ext.Fields) != 2 {
+		t.Fatalf("Fields: got %d, want 2: %+v", len(ext.Fields), ext.Fields)
+	}
+	if ext.Fields[0].Key != "color" || ext.Fields[0].Value != "blue" {
+		t.Errorf("Fields[0]: got %+v, want color=blue", ext.Fields[0])
+	}
+	if ext.Fields[1].Key != "weight" || ext.Fields[1].Value != "3" {
+		t.Errorf("Fields[1]: got %+v, want weight=3", ext.Fields[1])
+	}
+	if ext.Source != "import" {
+		t.Errorf("Source: got %s, want import", ext.Source)
+	}
+	if ext.Note != "profile note" {
+		t.Errorf("Note: got %s, want profile note", ext.Note)
+	}
+}
+
+// TestPathAttribute tests reading an attribute of an intermediate path element with "@name"
+func TestPathAttribute(t *testing.T) {
+	type Line struct {
+		XMLName  xml.Name `xml:"line"`
+		Amount   int      `xml:"details>quantity>amount"`
+		Unit     string   `xml:"details>quantity>@unit"`
+		Scale    *int     `xml:"details>quantity>@ns1:scale"`
+		Currency string   `xml:"price>@currency"`
+		Missing  string   `xml:"details>quantity>@missing"`
+	}
+
+	xmlData := []byte(`<line xmlns:ns1="http://example.com/schema/profile">
+		<price currency="EUR">12</price>
+		<details>
+			<quantity unit="kg" ns1:scale="3">
+				<amount>42</amount>
+			</quantity>
+		</details>
+	</line>`)
+
+	var line Line
+	err := xmlctx.Unmarshal(xmlData, &line, xmlctx.WithNamespaces(map[string]string{"ns1": NS1URL}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if line.Amount != 42 {
+		t.Errorf("Amount: got %d, want 42", line.Amount)
+	}
+	if line.Unit != "kg" {
+		t.Errorf("Unit: got %s, want kg", line.Unit)
+	}
+	if line.Scale == nil || *line.Scale != 3 {
+		t.Errorf("Scale: got %v, want 3", line.Scale)
+	}
+	if line.Currency != "EUR" {
+		t.Errorf("Currency: got %s, want EUR", line.Currency)
+	}
+	if line.Missing != "" {
+		t.Errorf("Missing: got %s, want empty", line.Missing)
+	}
+}
+
+// TestBestEffort tests keeping partially decoded data when a truncated document fails
+func TestBestEffort(t *testing.T) {
+	type Feed struct {
+		XMLName xml.Name `xml:"feed"`
+		ID      string   `xml:"id,attr"`
+		Title   string   `xml:"title"`
+		Entries []string `xml:"entry"`
+	}
+
+	// Truncated in the middle of the third entry
+	xmlData := []byte(`<feed id="f1">
+		<title>News</title>
+		<entry>one</entry>
+		<entry>two</entry>
+		<entry>thr`)
+
+	t.Run("Parse with best effort", func(t *testing.T) {
+		feed, err := xmlctx.Parse[Feed](xmlData, xmlctx.WithBestEffort())
+		if err == nil {
+			t.Fatal("Expected syntax error for truncated document, got nil")
+		}
+		var syntaxErr *xml.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Expected *xml.SyntaxError, got %T: %v", err, err)
+		}
+		if feed.ID != "f1" {
+			t.Errorf("ID: got %s, want f1", feed.ID)
+		}
+		if feed.Title != "News" {
+			t.Errorf("Title: got %s, want News", feed.Title)
+		}
+		if len(feed.Entries) != 2 || feed.Entries[1] != "two" {
+			t.Errorf("Entries: got %v, want [one two]", feed.Entries)
+		}
+	})
+
+	t.Run("Parse without best effort", func(t *testing.T) {
+		feed, err := xmlctx.Parse[Feed](xmlData)
+		if err == nil {
+			t.Fatal("Expected syntax error for truncated document, got nil")
+		}
+		if feed.Title != "" || feed.Entries != nil {
+			t.Errorf("Expected zero value, got %+v", feed)
+		}
+	})
+
+	t.Run("Unmarshal", func(t *testing.T) {
+		var feed Feed
+		err := xmlctx.Unmarshal(xmlData, &feed, xmlctx.WithBestEffort())
+		if err == nil {
+			t.Fatal("Expected syntax error for truncated document, got nil")
+		}
+		if feed.Title != "News" || len(feed.Entries) != 2 {
+			t.Errorf("Expected partial data, got %+v", feed)
+		}
+	})
+}
+
+// FinalizedName derives FullName from its decoded parts in Finalize
+type FinalizedName struct {
+	First    string `xml:"first"`
+	Last     string `xml:"last"`
+	FullName string
+}
+
+// Finalize implements xmlctx.Finalizer
+func (n *FinalizedName) Finalize() error {
+	if n.Last == "" {
+		return fmt.Errorf("name %q has no last name", n.First)
+	}
+	n.FullName = n.First + " " + n.Last
+	return nil
+}
+
+// TestFinalizer tests the post-decode Finalize hook
+func TestFinalizer(t *testing.T) {
+	type Contact struct {
+		XMLName xml.Name        `xml:"contact"`
+		Names   []FinalizedName `xml:"name"`
+	}
+
+	t.Run("derives fields", func(t *testing.T) {
+		xmlData := []byte(`<contact>
+			<name><first>Ada</first><last>Lovelace</last></name>
+			<name><last>Hopper</last><first>Grace</first></name>
+		</contact>`)
+
+		var contact Contact
+		if err := xmlctx.Unmarshal(xmlData, &contact); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if len(contact.Names) != 2 {
+			t.Fatalf("Names: got %d, want 2", len(contact.Names))
+		}
+		if contact.Names[0].FullName != "Ada Lovelace" {
+			t.Errorf("Names[0].FullName: got %s, want Ada Lovelace", contact.Names[0].FullName)
+		}
+		if contact.Names[1].FullName != "Grace Hopper" {
+			t.Errorf("Names[1].FullName: got %s, want Grace Hopper", contact.Names[1].FullName)
+		}
+	})
+
+	t.Run("error aborts decoding", func(t *testing.T) {
+		xmlData := []byte(`<contact><name><first>Plato</first></name></contact>`)
+
+		var contact Contact
+		err := xmlctx.Unmarshal(xmlData, &contact)
+		if err == nil {
+			t.Fatal("Expected error from Finalize, got nil")
+		}
+		if !strings.Contains(err.Error(), "has no last name") {
+			t.Errorf("Error should come from Finalize, got: %v", err)
+		}
+	})
+}
+
+// TestInnerXMLDeclaresNamespaces tests that captured innerxml declares the
+// namespaces it uses and can be parsed again on its own
+func TestInnerXMLDeclaresNamespaces(t *testing.T) {
+	type Envelope struct {
+		XMLName xml.Name `xml:"envelope"`
+		Body    string   `xml:",innerxml"`
+	}
+
+	xmlData := []byte(`<envelope xmlns="http://example.com/schema/user" xmlns:p="http://example.com/schema/profile" xmlns:x="http://example.com/other">
+		<p:profile x:visibility="public"><p:bio>Engineer &amp; writer</p:bio></p:profile>
+		<name>John</name>
+	</envelope>`)
+
+	var env Envelope
+	err := xmlctx.Unmarshal(xmlData, &env, xmlctx.WithNamespaces(map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	// Prefixes come from the namespace map, or are generated when unmapped
+	want := `<ns1:profile xmlns:ns1="http://example.com/schema/profile" xmlns:ns2="http://example.com/other" ns2:visibility="public"><ns1:bio>Engineer &amp; writer</ns1:bio></ns1:profile>`
+	if !strings.Contains(env.Body, want) {
+		t.Errorf("Body: got %s, want to contain %s", env.Body, want)
+	}
+	if !strings.Contains(env.Body, `<name xmlns="http://example.com/schema/user">John</name>`) {
+		t.Errorf("Body: got %s, want name in the default namespace", env.Body)
+	}
+
+	// Each captured element parses on its own with the original namespaces
+	type Profile struct {
+		Visibility string `xml:"http://example.com/other visibility,attr"`
+		Bio        string `xml:"http://example.com/schema/profile bio"`
+	}
+	type Fragment struct {
+		Profile Profile `xml:"http://example.com/schema/profile profile"`
+		Name    string  `xml:"http://example.com/schema/user name"`
+	}
+	var fragment Fragment
+	if err := xml.Unmarshal([]byte("<fragment>"+env.Body+"</fragment>"), &fragment); err != nil {
+		t.Fatalf("Failed to re-parse innerxml: %v", err)
+	}
+	if fragment.Profile.Bio != "Engineer & writer" {
+		t.Errorf("Profile.Bio: got %s, want Engineer & writer", fragment.Profile.Bio)
+	}
+	if fragment.Profile.Visibility != "public" {
+		t.Errorf("Profile.Visibility: got %s, want public", fragment.Profile.Visibility)
+	}
+	if fragment.Name != "John" {
+		t.Errorf("Name: got %s, want John", fragment.Name)
+	}
+}
+
+// TestUnsupportedTypeError tests that unsupported type errors name the field and type
+func TestUnsupportedTypeError(t *testing.T) {
+	type Settings struct {
+		Rate complex128 `xml:"rate"`
+	}
+	type Config struct {
+		XMLName  xml.Name    `xml:"config"`
+		Events   chan int    `xml:"events,attr"`
+		Settings Settings    `xml:"settings"`
+		Limits   []complex64 `xml:"limits>limit"`
+	}
+
+	tests := []struct {
+		name  string
+		xml   string
+		field string
+		typ   string
+	}{
+		{"attribute", `<config events="1"/>`, "Events", "chan int"},
+		{"nested element", `<config><settings><rate>1</rate></settings></config>`, "Settings.Rate", "complex128"},
+		{"path slice element", `<config><limits><limit>1</limit></limits></config>`, "Limits", "complex64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			err := xmlctx.Unmarshal([]byte(tt.xml), &config)
+			var unsupported *xmlctx.UnsupportedTypeError
+			if !errors.As(err, &unsupported) {
+				t.Fatalf("Expected *xmlctx.UnsupportedTypeError, got %T: %v", err, err)
+			}
+			if unsupported.Field != tt.field {
+				t.Errorf("Field: got %s, want %s", unsupported.Field, tt.field)
+			}
+			if unsupported.Type.String() != tt.typ {
+				t.Errorf("Type: got %v, want %s", unsupported.Type, tt.typ)
+			}
+			if !strings.Contains(err.Error(), tt.field) {
+				t.Errorf("Error should name the field, got: %v", err)
+			}
+		})
+	}
+}
+
+// TestAttributeWithScalarCharData tests elements carrying attributes around a
+// typed scalar value, like <amount currency="USD">1999</amount>
+func TestAttributeWithScalarCharData(t *testing.T) {
+	type Amount struct {
+		Currency string `xml:"currency,attr"`
+		Value    int    `xml:",chardata"`
+	}
+	type Invoice struct {
+		XMLName  xml.Name `xml:"invoice"`
+		Total    Amount   `xml:"total"`
+		Discount *Amount  `xml:"discount"`
+		Lines    []Amount `xml:"line"`
+	}
+
+	t.Run("as root", func(t *testing.T) {
+		amount, err := xmlctx.Parse[Amount]([]byte(`<amount currency="USD">1999</amount>`))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if amount.Currency != "USD" || amount.Value != 1999 {
+			t.Errorf("Amount: got %+v, want {USD 1999}", amount)
+		}
+	})
+
+	t.Run("as fields", func(t *testing.T) {
+		xmlData := []byte(`<invoice>
+			<total currency="EUR">
+				2500
+			</total>
+			<discount currency="EUR">-100</discount>
+			<line currency="EUR">1200</line>
+			<line currency="EUR">1300</line>
+			<line currency="EUR"/>
+		</invoice>`)
+
+		var invoice Invoice
+		if err := xmlctx.Unmarshal(xmlData, &invoice); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if invoice.Total.Currency != "EUR" || invoice.Total.Value != 2500 {
+			t.Errorf("Total: got %+v, want {EUR 2500}", invoice.Total)
+		}
+		if invoice.Discount == nil || invoice.Discount.Value != -100 {
+			t.Errorf("Discount: got %+v, want -100", invoice.Discount)
+		}
+		if len(invoice.Lines) != 3 {
+			t.Fatalf("Lines: got %d, want 3", len(invoice.Lines))
+		}
+		if invoice.Lines[1].Value != 1300 {
+			t.Errorf("Lines[1].Value: got %d, want 1300", invoice.Lines[1].Value)
+		}
+		// An empty element leaves the value at zero
+		if invoice.Lines[2].Value != 0 || invoice.Lines[2].Currency != "EUR" {
+			t.Errorf("Lines[2]: got %+v, want {EUR 0}", invoice.Lines[2])
+		}
+	})
+
+	t.Run("float value", func(t *testing.T) {
+		type Price struct {
+			Currency string  `xml:"currency,attr"`
+			Value    float64 `xml:",chardata"`
+		}
+		price, err := xmlctx.Parse[Price]([]byte(`<amount currency="USD">19.99</amount>`))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if price.Currency != "USD" || price.Value != 19.99 {
+			t.Errorf("Price: got %+v, want {USD 19.99}", price)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := xmlctx.Parse[Amount]([]byte(`<amount currency="USD">lots</amount>`))
+		if err == nil {
+			t.Error("Expected error for non-numeric amount, got nil")
+		}
+	})
+}
+
+// TestElementOrderIndependence tests that fields are populated regardless of
+// the order of elements in the document
+func TestElementOrderIndependence(t *testing.T) {
+	type Party struct {
+		Role string `xml:"role,attr"`
+		Name string `xml:"name"`
+		ID   string `xml:"id"`
+	}
+	type Order struct {
+		XMLName  xml.Name `xml:"order"`
+		ID       string   `xml:"id,attr"`
+		Status   string   `xml:"status,attr"`
+		Number   string   `xml:"number"`
+		Buyer    Party    `xml:"buyer"`
+		Notes    []string `xml:"note"`
+		City     string   `xml:"delivery>address>city"`
+		Country  string   `xml:"delivery>address>country"`
+		Unit     string   `xml:"delivery>weight>@unit"`
+		Weight   int      `xml:"delivery>weight"`
+		Currency string   `xml:"totals>@currency"`
+		Total    int      `xml:"totals>grand"`
+		Tax      int      `xml:"totals>tax"`
+	}
+
+	want := Order{
+		ID:       "o-1",
+		Status:   "open",
+		Number:   "N-42",
+		Buyer:    Party{Role: "buyer", Name: "ACME", ID: "B1"},
+		Notes:    []string{"first", "second"},
+		City:     "Madrid",
+		Country:  "ES",
+		Unit:     "kg",
+		Weight:   12,
+		Currency: "EUR",
+		Total:    121,
+		Tax:      21,
+	}
+
+	documents := map[string]string{
+		"struct order": `<order id="o-1" status="open">
+			<number>N-42</number>
+			<buyer role="buyer"><name>ACME</name><id>B1</id></buyer>
+			<note>first</note>
+			<note>second</note>
+			<delivery>
+				<address><city>Madrid</city><country>ES</country></address>
+				<weight unit="kg">12</weight>
+			</delivery>
+			<totals currency="EUR"><grand>121</grand><tax>21</tax></totals>
+		</order>`,
+		"reversed": `<order status="open" id="o-1">
+			<totals currency="EUR"><tax>21</tax><grand>121</grand></totals>
+			<delivery>
+				<weight unit="kg">12</weight>
+				<address><country>ES</country><city>Madrid</city></address>
+			</delivery>
+			<note>first</note>
+			<buyer role="buyer"><id>B1</id><name>ACME</name></buyer>
+			<note>second</note>
+			<number>N-42</number>
+		</order>`,
+		"path wrappers first and repeated": `<order id="o-1" status="open">
+			<delivery><unknown>skip me</unknown><address><country>ES</country></address><address><city>Madrid</city></address></delivery>
+			<totals><tax>21</tax></totals>
+			<note>first</note>
+			<delivery><weight unit="kg">12</weight></delivery>
+			<buyer role="buyer"><id>B1</id><name>ACME</name></buyer>
+			<totals currency="EUR"><grand>121</grand></totals>
+			<number>N-42</number>
+			<note>second</note>
+		</order>`,
+	}
+
+	for name, doc := range documents {
+		t.Run(name, func(t *testing.T) {
+			var order Order
+			if err := xmlctx.Unmarshal([]byte(doc), &order); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			order.XMLName = xml.Name{}
+			if fmt.Sprintf("%+v", order) != fmt.Sprintf("%+v", want) {
+				t.Errorf("Order:\n got %+v\nwant %+v", order, want)
+			}
+		})
+	}
+}
+
+// TestStringInterning tests that identical decoded strings share storage
+func TestStringInterning(t *testing.T) {
+	type Line struct {
+		Currency string `xml:"currency,attr"`
+		Country  string `xml:"country"`
+		Note     string `xml:",chardata"`
+	}
+	type Invoice struct {
+		XMLName xml.Name `xml:"invoice"`
+		Lines   []Line   `xml:"line"`
+	}
+
+	xmlData := []byte(`<invoice>
+		<line currency="EUR"><country>Spain</country>same</line>
+		<line currency="EUR"><country>Spain</country>same</line>
+		<line currency="USD"><country>Portugal</country>other</line>
+	</invoice>`)
+
+	decode := func(opts ...xmlctx.Option) Invoice {
+		var invoice Invoice
+		if err := xmlctx.Unmarshal(xmlData, &invoice, opts...); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if len(invoice.Lines) != 3 {
+			t.Fatalf("Lines: got %d, want 3", len(invoice.Lines))
+		}
+		return invoice
+	}
+	shared := func(a, b string) bool {
+		return unsafe.StringData(a) == unsafe.StringData(b)
+	}
+
+	invoice := decode(xmlctx.WithStringInterning())
+	first, second, third := invoice.Lines[0], invoice.Lines[1], invoice.Lines[2]
+	if !shared(first.Country, second.Country) {
+		t.Error("Country: identical element text should share storage")
+	}
+	if !shared(first.Currency, second.Currency) {
+		t.Error("Currency: identical attribute values should share storage")
+	}
+	if !shared(first.Note, second.Note) {
+		t.Error("Note: identical chardata should share storage")
+	}
+	if third.Country != "Portugal" || third.Currency != "USD" || third.Note != "other" {
+		t.Errorf("Lines[2]: got %+v, want {USD Portugal other}", third)
+	}
+
+	// Without the option each value has its own storage
+	invoice = decode()
+	if shared(invoice.Lines[0].Country, invoice.Lines[1].Country) {
+		t.Error("Country: strings should not be shared without interning")
+	}
+}
+
+// TestElementScopedNamespaceDeclarations tests elements that declare the
+// namespaces they use themselves, including a prefix reused with a different
+// URI on a sibling
+func TestElementScopedNamespaceDeclarations(t *testing.T) {
+	type Item struct {
+		Kind  string `xml:"p:kind,attr"`
+		Label string `xml:"p:label"`
+		Code  string `xml:"a:code"`
+	}
+	type Catalog struct {
+		XMLName xml.Name `xml:"catalog"`
+		Profile Item     `xml:"p:item"`
+		Address Item     `xml:"a:item"`
+		Bio     string   `xml:"p:details>p:bio"`
+		City    string   `xml:"a:details>a:city"`
+		Level   string   `xml:"p:details>@p:level"`
+	}
+
+	namespaces := xmlctx.WithNamespaces(map[string]string{
+		"p": NS1URL,
+		"a": NS2URL,
+	})
+
+	// The document binds "x" to the profile namespace on one sibling and to
+	// the address namespace on the next; only resolved URIs matter
+	xmlData := []byte(`<catalog>
+		<x:item xmlns:x="http://example.com/schema/profile" x:kind="profile">
+			<x:label>Profile item</x:label>
+			<x:code>wrong scope</x:code>
+		</x:item>
+		<x:item xmlns:x="http://example.com/schema/address">
+			<x:code>ADDR-1</x:code>
+			<x:label>wrong scope</x:label>
+		</x:item>
+		<x:details xmlns:x="http://example.com/schema/profile" x:level="3">
+			<x:bio>Engineer</x:bio>
+			<x:city>wrong scope</x:city>
+		</x:details>
+		<x:details xmlns:x="http://example.com/schema/address" x:level="9">
+			<x:city>Lisbon</x:city>
+			<x:bio>wrong scope</x:bio>
+		</x:details>
+	</catalog>`)
+
+	var catalog Catalog
+	if err := xmlctx.Unmarshal(xmlData, &catalog, namespaces); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if catalog.Profile.Kind != "profile" {
+		t.Errorf("Profile.Kind: got %s, want profile", catalog.Profile.Kind)
+	}
+	if catalog.Profile.Label != "Profile item" {
+		t.Errorf("Profile.Label: got %s, want Profile item", catalog.Profile.Label)
+	}
+	if catalog.Profile.Code != "" {
+		t.Errorf("Profile.Code: got %s, want empty", catalog.Profile.Code)
+	}
+	if catalog.Address.Code != "ADDR-1" {
+		t.Errorf("Address.Code: got %s, want ADDR-1", catalog.Address.Code)
+	}
+	if catalog.Address.Label != "" {
+		t.Errorf("Address.Label: got %s, want empty", catalog.Address.Label)
+	}
+	if catalog.Bio != "Engineer" {
+		t.Errorf("Bio: got %s, want Engineer", catalog.Bio)
+	}
+	if catalog.City != "Lisbon" {
+		t.Errorf("City: got %s, want Lisbon", catalog.City)
+	}
+	if catalog.Level != "3" {
+		t.Errorf("Level: got %s, want 3", catalog.Level)
+	}
+}
+
+// TestIndexField tests ,index fields receiving the element's position in its slice
+func TestIndexField(t *testing.T) {
+	type Part struct {
+		Pos  int    `xml:",index"`
+		Name string `xml:"name"`
+	}
+	type Item struct {
+		Pos   int     `xml:",index"`
+		Name  string  `xml:"name"`
+		Parts []*Part `xml:"part"`
+	}
+	type List struct {
+		XMLName xml.Name `xml:"list"`
+		Pos     int      `xml:",index"`
+		Items   []Item   `xml:"item"`
+	}
+
+	xmlData := []byte(`<list>
+		<item><name>a</name></item>
+		<item><name>b</name><part><name>b0</name></part><part><name>b1</name></part></item>
+		<item><name>c</name></item>
+	</list>`)
+
+	var list List
+	if err := xmlctx.Unmarshal(xmlData, &list); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(list.Items) != 3 {
+		t.Fatalf("Items: got %d, want 3", len(list.Items))
+	}
+	for i, item := range list.Items {
+		if item.Pos != i {
+			t.Errorf("Items[%d].Pos: got %d, want %d", i, item.Pos, i)
+		}
+	}
+	parts := list.Items[1].Parts
+	if len(parts) != 2 || parts[0].Pos != 0 || parts[1].Pos != 1 {
+		t.Errorf("Parts: got %+v %+v, want positions 0 and 1", parts[0], parts[1])
+	}
+	// Structs outside a slice keep their ,index field untouched
+	if list.Pos != 0 {
+		t.Errorf("Pos: got %d, want 0", list.Pos)
+	}
+
+	// Root slices number their elements too
+	items, err := xmlctx.Parse[[]Item]([]byte(`<items><item/><item/></items>`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(items) != 2 || items[1].Pos != 1 {
+		t.Errorf("Root items: got %+v, want positions 0 and 1", items)
+	}
+}
+
+// TestScalarContentWithCommentsAndNestedElements tests that scalar elements
+// ignore comments and nested elements, parsing the remaining trimmed text
+func TestScalarContentWithCommentsAndNestedElements(t *testing.T) {
+	type Settings struct {
+		XMLName xml.Name `xml:"settings"`
+		Enabled bool     `xml:"enabled"`
+		Retries int      `xml:"retries"`
+		Port    uint     `xml:"port"`
+		Name    string   `xml:"name"`
+		After   string   `xml:"after"`
+	}
+
+	xmlData := []byte(`<settings>
+		<enabled> <!-- note --> true </enabled>
+		<retries><!-- a -->3<!-- b --></retries>
+		<port>80<extra>ignored</extra>80</port>
+		<name>srv<!-- x -->01<nested><deep>skip</deep></nested></name>
+		<after>still decoded</after>
+	</settings>`)
+
+	var settings Settings
+	if err := xmlctx.Unmarshal(xmlData, &settings); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if !settings.Enabled {
+		t.Error("Enabled: got false, want true")
+	}
+	if settings.Retries != 3 {
+		t.Errorf("Retries: got %d, want 3", settings.Retries)
+	}
+	if settings.Port != 8080 {
+		t.Errorf("Port: got %d, want 8080", settings.Port)
+	}
+	if settings.Name != "srv01" {
+		t.Errorf("Name: got %s, want srv01", settings.Name)
+	}
+	// Nested elements are skipped whole, so later siblings still decode
+	if settings.After != "still decoded" {
+		t.Errorf("After: got %s, want still decoded", settings.After)
+	}
+}
+
+// TestSchema tests validating required elements, cardinalities, and namespaces while decoding
+func TestSchema(t *testing.T) {
+	type Line struct {
+		Name string `xml:"name"`
+	}
+	type Invoice struct {
+		XMLName xml.Name `xml:"invoice"`
+		Number  string   `xml:"number"`
+		Lines   []Line   `xml:"line"`
+	}
+
+	schema := &xmlctx.Schema{
+		Elements: map[string]xmlctx.ElementSchema{
+			"invoice": {Children: []xmlctx.ChildSchema{
+				{Name: "number", Min: 1, Max: 1},
+				{Name: "line", Min: 1, Max: 2},
+			}},
+			"line": {Children: []xmlctx.ChildSchema{
+				{Name: "name", Min: 1},
+			}},
+		},
+		Namespaces: []string{""},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		xmlData := []byte(`<invoice><number>1</number><line><name>a</name></line></invoice>`)
+		var invoice Invoice
+		if err := xmlctx.Unmarshal(xmlData, &invoice, xmlctx.WithSchema(schema)); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+	})
+
+	t.Run("violations", func(t *testing.T) {
+		xmlData := []byte(`<invoice>
+			<line><name>a</name></line>
+			<line><name>b</name></line>
+			<line></line>
+			<x:note xmlns:x="http://example.com/other">n</x:note>
+		</invoice>`)
+
+		var invoice Invoice
+		err := xmlctx.Unmarshal(xmlData, &invoice, xmlctx.WithSchema(schema))
+		var schemaErr *xmlctx.SchemaError
+		if !errors.As(err, &schemaErr) {
+			t.Fatalf("Expected *xmlctx.SchemaError, got %T: %v", err, err)
+		}
+
+		// Decoding still completes, so the value can be inspected
+		if len(invoice.Lines) != 3 {
+			t.Errorf("Lines: got %d, want 3", len(invoice.Lines))
+		}
+
+		want := []xmlctx.SchemaViolation{
+			{Element: "line", Child: "name", Count: 0, Message: "element line: missing required child name"},
+			{Element: "invoice", Child: "{http://example.com/other}note", Count: 1, Message: `element {http://example.com/other}note: namespace "http://example.com/other" is not allowed`},
+			{Element: "invoice", Child: "number", Count: 0, Message: "element invoice: missing required child number"},
+			{Element: "invoice", Child: "line", Count: 3, Message: "element invoice: child line occurs 3 times, want at most 2"},
+		}
+		if len(schemaErr.Violations) != len(want) {
+			t.Fatalf("Violations: got %+v, want %+v", schemaErr.Violations, want)
+		}
+		for i := range want {
+			if schemaErr.Violations[i] != want[i] {
+				t.Errorf("Violations[%d]: got %+v, want %+v", i, schemaErr.Violations[i], want[i])
+			}
+		}
+	})
+	t.Run("overlapping tags", func(t *testing.T) {
+		// Both tags match <line>; the first in sorted order applies every time
+		overlapping := &xmlctx.Schema{
+			Elements: map[string]xmlctx.ElementSchema{
+				"ns1:line":        {Children: []xmlctx.ChildSchema{{Name: "name", Min: 1}}},
+				"{urn:ns1}line":   {Children: []xmlctx.ChildSchema{{Name: "code", Min: 1}}},
+				"{urn:ns1}line2":  {},
+				"{urn:other}line": {},
+			},
+		}
+		type Doc struct {
+			XMLName xml.Name `xml:"doc"`
+			Line    Line     `xml:"ns1:line"`
+		}
+		xmlData := []byte(`<doc xmlns:a="urn:ns1"><a:line/></doc>`)
+		for range 20 {
+			var doc Doc
+			err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithSchema(overlapping), xmlctx.WithNamespace("ns1", "urn:ns1"))
+			var schemaErr *xmlctx.SchemaError
+			if !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 1 || schemaErr.Violations[0].Child != "name" {
+				t.Fatalf("Violations: got %v, want missing name only", err)
+			}
+		}
+	})
+}
+
+// TestChannelField tests sending each matching element on a channel field as it is decoded
+func TestChannelField(t *testing.T) {
+	type Item struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+	type Feed struct {
+		XMLName xml.Name  `xml:"feed"`
+		Title   string    `xml:"title"`
+		Items   chan Item `xml:"item"`
+	}
+
+	xmlData := []byte(`<feed>
+		<title>Stream</title>
+		<item id="1"><name>one</name></item>
+		<item id="2"><name>two</name></item>
+		<item id="3"><name>three</name></item>
+	</feed>`)
+
+	t.Run("consumer goroutine", func(t *testing.T) {
+		feed := Feed{Items: make(chan Item)}
+		var received []Item
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for item := range feed.Items {
+				received = append(received, item)
+			}
+		}()
+
+		if err := xmlctx.Unmarshal(xmlData, &feed); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		// The channel is closed at the end of <feed>, ending the consumer's range
+		<-done
+
+		if feed.Title != "Stream" {
+			t.Errorf("Title: got %s, want Stream", feed.Title)
+		}
+		if len(received) != 3 {
+			t.Fatalf("Received: got %d items, want 3", len(received))
+		}
+		if received[2].ID != "3" || received[2].Name != "three" {
+			t.Errorf("Received[2]: got %+v, want {3 three}", received[2])
+		}
+	})
+
+	t.Run("nil channel", func(t *testing.T) {
+		var feed Feed
+		if err := xmlctx.Unmarshal(xmlData, &feed); err == nil {
+			t.Error("Expected error for nil channel field, got nil")
+		}
+	})
+
+	t.Run("repeated parent", func(t *testing.T) {
+		type Digest struct {
+			XMLName xml.Name `xml:"digest"`
+			Feed    Feed     `xml:"feed"`
+		}
+		digest := Digest{Feed: Feed{Items: make(chan Item, 4)}}
+		data := []byte(`<digest>
+			<feed><item id="1"/></feed>
+			<feed><item id="2"/></feed>
+		</digest>`)
+		err := xmlctx.Unmarshal(data, &digest)
+		if err == nil || !strings.Contains(err.Error(), "channel closed") {
+			t.Errorf("Expected closed channel error, got %v", err)
+		}
+		// The channel was closed once, after the first feed
+		var received []Item
+		for item := range digest.Feed.Items {
+			received = append(received, item)
+		}
+		if len(received) != 1 || received[0].ID != "1" {
+			t.Errorf("Received: got %+v, want the first feed's item", received)
+		}
+
+		// A repeated parent without items closes the channel only once
+		digest = Digest{Feed: Feed{Items: make(chan Item, 4)}}
+		if err := xmlctx.Unmarshal([]byte(`<digest><feed/><feed/></digest>`), &digest); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+	})
+}
+
+// TestTimeLocation tests converting decoded times to a configured location
+func TestTimeLocation(t *testing.T) {
+	type Event struct {
+		XMLName  xml.Name    `xml:"event"`
+		Created  time.Time   `xml:"created,attr"`
+		Start    time.Time   `xml:"start"`
+		End      *time.Time  `xml:"end"`
+		Reminder []time.Time `xml:"reminder"`
+	}
+
+	xmlData := []byte(`<event created="2024-03-01T08:00:00-05:00">
+		<start>2024-03-10T10:30:00+02:00</start>
+		<end>2024-03-10T12:00:00+02:00</end>
+		<reminder>2024-03-09T09:00:00+01:00</reminder>
+	</event>`)
+
+	var event Event
+	if err := xmlctx.Unmarshal(xmlData, &event, xmlctx.WithTimeLocation(time.UTC)); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	check := func(name string, got time.Time, want string) {
+		t.Helper()
+		if got.Location() != time.UTC {
+			t.Errorf("%s: got location %v, want UTC", name, got.Location())
+		}
+		if s := got.Format(time.RFC3339); s != want {
+			t.Errorf("%s: got %s, want %s", name, s, want)
+		}
+	}
+	check("Created", event.Created, "2024-03-01T13:00:00Z")
+	check("Start", event.Start, "2024-03-10T08:30:00Z")
+	if event.End == nil {
+		t.Fatal("End: got nil")
+	}
+	check("End", *event.End, "2024-03-10T10:00:00Z")
+	if len(event.Reminder) != 1 {
+		t.Fatalf("Reminder: got %d, want 1", len(event.Reminder))
+	}
+	check("Reminder", event.Reminder[0], "2024-03-09T08:00:00Z")
+
+	// Without the option the original offset is kept
+	if err := xmlctx.Unmarshal(xmlData, &event); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if _, offset := event.Start.Zone(); offset != 2*60*60 {
+		t.Errorf("Start offset: got %d, want %d", offset, 2*60*60)
+	}
+}
+
+// TestDeclaration tests reading the version and encoding of the XML declaration
+func TestDeclaration(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		Value   string   `xml:"value"`
+	}
+
+	tests := []struct {
+		name     string
+		xml      string
+		version  string
+		encoding string
+	}{
+		{"double quotes", `<?xml version="1.0" encoding="UTF-8"?><doc><value>x</value></doc>`, "1.0", "UTF-8"},
+		{"single quotes and spacing", "<?xml version = '1.1'\n  encoding='utf-8' standalone='yes'?>\n<doc/>", "1.1", "utf-8"},
+		{"no encoding", `<?xml version="1.0"?><doc/>`, "1.0", ""},
+		{"no declaration", `<doc/>`, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := xmlctx.NewDecoder(strings.NewReader(tt.xml))
+			var doc Doc
+			if err := dec.Decode(&doc); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			version, encoding := dec.Declaration()
+			if version != tt.version {
+				t.Errorf("Version: got %q, want %q", version, tt.version)
+			}
+			if encoding != tt.encoding {
+				t.Errorf("Encoding: got %q, want %q", encoding, tt.encoding)
+			}
+		})
+	}
+}
+
+// TestClarkNotationTags tests tags naming their namespace URI inline as {uri}local
+func TestClarkNotationTags(t *testing.T) {
+	type Record struct {
+		XMLName xml.Name `xml:"record"`
+		Name    string   `xml:"name"`
+		Bio     string   `xml:"ns1:bio"`
+		ID      string   `xml:"{http://example.com/other}id"`
+		Kind    string   `xml:"{http://example.com/other}kind,attr"`
+		Code    string   `xml:"meta>{http://example.com/other}code"`
+	}
+
+	xmlData := []byte(`<record xmlns="http://example.com/schema/user" xmlns:p="http://example.com/schema/profile" xmlns:o="http://example.com/other" o:kind="person">
+		<name>Ada</name>
+		<p:bio>Mathematician</p:bio>
+		<id>wrong namespace</id>
+		<o:id>42</o:id>
+		<meta><o:code>X1</o:code></meta>
+	</record>`)
+
+	var record Record
+	err := xmlctx.Unmarshal(xmlData, &record, xmlctx.WithNamespaces(map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if record.Name != "Ada" {
+		t.Errorf("Name: got %s, want Ada", record.Name)
+	}
+	if record.Bio != "Mathematician" {
+		t.Errorf("Bio: got %s, want Mathematician", record.Bio)
+	}
+	// The inline URI is used even though it isn't in the namespace map
+	if record.ID != "42" {
+		t.Errorf("ID: got %s, want 42", record.ID)
+	}
+	if record.Kind != "person" {
+		t.Errorf("Kind: got %s, want person", record.Kind)
+	}
+	if record.Code != "X1" {
+		t.Errorf("Code: got %s, want X1", record.Code)
+	}
+}
+
+// TestVerifyCounts tests checking decoded slice lengths against declared counts
+func TestVerifyCounts(t *testing.T) {
+	type Batch struct {
+		XMLName xml.Name `xml:"batch"`
+		Items   []string `xml:"item,cap=count"`
+	}
+
+	complete := []byte(`<batch count="3"><item>a</item><item>b</item><item>c</item></batch>`)
+	truncated := []byte(`<batch count="5"><item>a</item><item>b</item><item>c</item></batch>`)
+
+	var batch Batch
+	if err := xmlctx.Unmarshal(complete, &batch, xmlctx.WithVerifyCounts()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(batch.Items) != 3 {
+		t.Errorf("Items: got %d, want 3", len(batch.Items))
+	}
+
+	// Without the option the count is only a capacity hint
+	batch = Batch{}
+	if err := xmlctx.Unmarshal(truncated, &batch); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	batch = Batch{}
+	err := xmlctx.Unmarshal(truncated, &batch, xmlctx.WithVerifyCounts())
+	if err == nil {
+		t.Fatal("Expected error for count mismatch, got nil")
+	}
+	if !strings.Contains(err.Error(), "declares 5 elements, got 3") {
+		t.Errorf("Error should report the mismatch, got: %v", err)
+	}
+
+	// Elements without the count attribute aren't checked
+	batch = Batch{}
+	if err := xmlctx.Unmarshal([]byte(`<batch><item>a</item></batch>`), &batch, xmlctx.WithVerifyCounts()); err != nil {
+		t.Errorf("Unexpected error without count attribute: %v", err)
+	}
+}
+
+// TestCharDataAndCDataFields tests splitting text between ,chardata and ,cdata fields
+func TestCharDataAndCDataFields(t *testing.T) {
+	type Note struct {
+		XMLName xml.Name `xml:"note"`
+		Text    string   `xml:",chardata"`
+		Raw     string   `xml:",cdata"`
+		Author  string   `xml:"author"`
+	}
+
+	data := []byte(`<note>
+		Plain text
+		<![CDATA[Raw <b>markup</b> & symbols]]>
+		<author>Ann</author>
+	</note>`)
+
+	var note Note
+	if err := xmlctx.Unmarshal(data, &note); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if note.Text != "Plain text" {
+		t.Errorf("Text: got %q, want %q", note.Text, "Plain text")
+	}
+	if note.Raw != "Raw <b>markup</b> & symbols" {
+		t.Errorf("Raw: got %q, want %q", note.Raw, "Raw <b>markup</b> & symbols")
+	}
+	if note.Author != "Ann" {
+		t.Errorf("Author: got %s, want Ann", note.Author)
+	}
+
+	// A CDATA opening inside a comment is not a CDATA section
+	data = []byte(`<note><!-- <![CDATA[ --><![CDATA[x]]>y</note>`)
+	note = Note{}
+	if err := xmlctx.Unmarshal(data, &note); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if note.Text != "y" || note.Raw != "x" {
+		t.Errorf("got Text %q and Raw %q, want y and x", note.Text, note.Raw)
+	}
+
+	// Notes nested in other values, and decoded from a captured copy of the
+	// element under WithSkipBadElements, split their text the same way
+	type Board struct {
+		XMLName xml.Name `xml:"board"`
+		Notes   []Note   `xml:"note"`
+		Count   int      `xml:"count"`
+	}
+	data = []byte(`<board><count>x</count><note>a<![CDATA[<b>]]></note><note><![CDATA[<i>]]>b</note></board>`)
+	var board Board
+	if err := xmlctx.Unmarshal(data, &board, xmlctx.WithSkipBadElements()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(board.Notes) != 2 {
+		t.Fatalf("Notes: got %d, want 2", len(board.Notes))
+	}
+	for i, want := range []Note{{Text: "a", Raw: "<b>"}, {Text: "b", Raw: "<i>"}} {
+		if board.Notes[i].Text != want.Text || board.Notes[i].Raw != want.Raw {
+			t.Errorf("Notes[%d]: got Text %q and Raw %q, want %q and %q", i, board.Notes[i].Text, board.Notes[i].Raw, want.Text, want.Raw)
+		}
+	}
+
+	// A ,text field replays the element to the other fields
+	type TextNote struct {
+		XMLName xml.Name `xml:"note"`
+		All     string   `xml:",text"`
+		Text    string   `xml:",chardata"`
+		Raw     string   `xml:",cdata"`
+	}
+	var textNote TextNote
+	if err := xmlctx.Unmarshal([]byte(`<note>a<![CDATA[<b>]]></note>`), &textNote); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if textNote.All != "a<b>" || textNote.Text != "a" || textNote.Raw != "<b>" {
+		t.Errorf("got All %q, Text %q and Raw %q, want a<b>, a and <b>", textNote.All, textNote.Text, textNote.Raw)
+	}
+}
+
+// TestNamespaceDeclarationsField tests capturing namespace declarations with an ,xmlns field
+func TestNamespaceDeclarationsField(t *testing.T) {
+	type Item struct {
+		Declared map[string]string `xml:",xmlns"`
+		Name     string            `xml:"ns1:name"`
+	}
+	type Catalog struct {
+		XMLName  xml.Name          `xml:"catalog"`
+		Declared map[string]string `xml:",xmlns"`
+		Items    []Item            `xml:"item"`
+	}
+
+	xmlData := []byte(`<catalog xmlns="http://example.com/catalog" xmlns:p="http://example.com/product" id="1">
+		<item><p:name>Pen</p:name></item>
+		<item xmlns:q="http://example.com/product"><q:name>Ink</q:name></item>
+	</catalog>`)
+
+	var catalog Catalog
+	err := xmlctx.Unmarshal(xmlData, &catalog, xmlctx.WithNamespaces(map[string]string{
+		"":    "http://example.com/catalog",
+		"ns1": "http://example.com/product",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if len(catalog.Declared) != 2 {
+		t.Fatalf("Declared: got %v, want 2 declarations", catalog.Declared)
+	}
+	if catalog.Declared[""] != "http://example.com/catalog" {
+		t.Errorf("Declared[\"\"]: got %s, want http://example.com/catalog", catalog.Declared[""])
+	}
+	if catalog.Declared["p"] != "http://example.com/product" {
+		t.Errorf("Declared[p]: got %s, want http://example.com/product", catalog.Declared["p"])
+	}
+
+	if len(catalog.Items) != 2 {
+		t.Fatalf("Items: got %d, want 2", len(catalog.Items))
+	}
+	if catalog.Items[0].Declared != nil {
+		t.Errorf("Items[0].Declared: got %v, want nil", catalog.Items[0].Declared)
+	}
+	if catalog.Items[1].Declared["q"] != "http://example.com/product" {
+		t.Errorf("Items[1].Declared[q]: got %s, want http://example.com/product", catalog.Items[1].Declared["q"])
+	}
+	if catalog.Items[1].Name != "Ink" {
+		t.Errorf("Items[1].Name: got %s, want Ink", catalog.Items[1].Name)
+	}
+}
+
+// TestPrefixField tests capturing the prefix the document used for an element
+// in a ,prefix field
+func TestPrefixField(t *testing.T) {
+	type Party struct {
+		Prefix string `xml:",prefix"`
+		Name   string `xml:"pty:name"`
+	}
+	type Carrier struct {
+		Prefix string `xml:",prefix"`
+	}
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		Prefix  string   `xml:",prefix"`
+		Buyer   Party    `xml:"pty:buyer"`
+		Seller  Party    `xml:"pty:seller"`
+		Carrier Carrier  `xml:"car:carrier"`
+	}
+
+	xmlData := []byte(`<order xmlns="urn:order" xmlns:a="urn:party">
+		<a:buyer><a:name>Ann</a:name></a:buyer>
+		<seller xmlns="urn:party"><name>Bob</name></seller>
+		<c:carrier xmlns:c="urn:carrier"/>
+	</order>`)
+
+	var order Order
+	err := xmlctx.Unmarshal(xmlData, &order, xmlctx.WithNamespaces(map[string]string{
+		"":    "urn:order",
+		"pty": "urn:party",
+		"car": "urn:carrier",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if order.Prefix != "" {
+		t.Errorf("Prefix: got %q, want empty", order.Prefix)
+	}
+	if order.Buyer.Prefix != "a" || order.Buyer.Name != "Ann" {
+		t.Errorf("Buyer: got %+v, want prefix a", order.Buyer)
+	}
+	// The seller redeclares the default namespace rather than using a:
+	if order.Seller.Prefix != "" || order.Seller.Name != "Bob" {
+		t.Errorf("Seller: got %+v, want empty prefix", order.Seller)
+	}
+	if order.Carrier.Prefix != "c" {
+		t.Errorf("Carrier.Prefix: got %q, want c", order.Carrier.Prefix)
+	}
+}
+
+// TestBaseNamespaceURI tests resolving relative namespace URIs against a base
+func TestBaseNamespaceURI(t *testing.T) {
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		ID      string   `xml:"ns1:id,attr"`
+		Total   int      `xml:"ns1:total"`
+	}
+
+	xmlData := []byte(`<order xmlns="orders/v2" xmlns:o="orders/v2" o:id="A1">
+		<o:total>30</o:total>
+	</order>`)
+	namespaces := map[string]string{
+		"":    "http://example.com/orders/v2",
+		"ns1": "http://example.com/orders/v2",
+	}
+
+	var order Order
+	err := xmlctx.Unmarshal(xmlData, &order,
+		xmlctx.WithNamespaces(namespaces),
+		xmlctx.WithBaseNamespaceURI("http://example.com/"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if order.ID != "A1" {
+		t.Errorf("ID: got %s, want A1", order.ID)
+	}
+	if order.Total != 30 {
+		t.Errorf("Total: got %d, want 30", order.Total)
+	}
+
+	// Without a base the relative namespace doesn't match the map
+	order = Order{}
+	if err := xmlctx.Unmarshal(xmlData, &order, xmlctx.WithNamespaces(namespaces)); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if order.Total != 0 {
+		t.Errorf("Total without base: got %d, want 0", order.Total)
+	}
+
+	// The base itself must be absolute
+	err = xmlctx.Unmarshal(xmlData, &order, xmlctx.WithBaseNamespaceURI("orders/"))
+	if err == nil {
+		t.Error("Expected error for relative base URI, got nil")
+	}
+}
+
+// TestUnmatchedElements tests recording the elements skipped while decoding
+func TestUnmatchedElements(t *testing.T) {
+	type Feed struct {
+		XMLName xml.Name `xml:"feed"`
+		Title   string   `xml:"title"`
+		Author  string   `xml:"meta>author"`
+	}
+
+	xmlData := []byte(`<feed xmlns:ext="http://partner.example.com/ext">
+		<title>News</title>
+		<ext:rating>5</ext:rating>
+		<meta><author>Ann</author><license>CC</license></meta>
+		<ext:rating>4</ext:rating>
+		<updated>2024-01-01</updated>
+	</feed>`)
+
+	var feed Feed
+	dec := xmlctx.NewDecoder(strings.NewReader(string(xmlData)))
+	if err := dec.Decode(&feed); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	want := []xml.Name{
+		{Space: "http://partner.example.com/ext", Local: "rating"},
+		{Local: "license"},
+		{Local: "updated"},
+	}
+	got := dec.UnmatchedElements()
+	if len(got) != len(want) {
+		t.Fatalf("UnmatchedElements: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("UnmatchedElements[%d]: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// Decimal is a fixed-precision decimal implementing encoding.TextUnmarshaler,
+// like the decimal types commonly used for money
+type Decimal struct {
+	units int64 // value scaled by 10^exp
+	exp   int
+}
+
+// UnmarshalText parses a decimal such as "-12.50"
+func (d *Decimal) UnmarshalText(text []byte) error {
+	s := string(text)
+	whole, frac, _ := strings.Cut(s, ".")
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid decimal %q", s)
+	}
+	d.units, d.exp = units, len(frac)
+	return nil
+}
+
+// String formats the decimal with its original precision
+func (d Decimal) String() string {
+	s := strconv.FormatInt(d.units, 10)
+	if d.exp == 0 {
+		return s
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	for len(s) <= d.exp {
+		s = "0" + s
+	}
+	s = s[:len(s)-d.exp] + "." + s[len(s)-d.exp:]
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// DecimalBytes is a decimal stored as its digits, so its kind is a slice
+type DecimalBytes []byte
+
+// UnmarshalText validates and stores the decimal's text
+func (d *DecimalBytes) UnmarshalText(text []byte) error {
+	var dec Decimal
+	if err := dec.UnmarshalText(text); err != nil {
+		return err
+	}
+	*d = DecimalBytes("D" + dec.String())
+	return nil
+}
+
+// DecimalDigits is a decimal stored as runes, so its kind is a slice of
+// non-byte elements
+type DecimalDigits []rune
+
+// UnmarshalText validates and stores the decimal's text
+func (d *DecimalDigits) UnmarshalText(text []byte) error {
+	var dec Decimal
+	if err := dec.UnmarshalText(text); err != nil {
+		return err
+	}
+	*d = DecimalDigits(dec.String())
+	return nil
+}
+
+// TestDecimalTextUnmarshaler tests decimal types in every position a value can be decoded into
+func TestDecimalTextUnmarshaler(t *testing.T) {
+	type Price struct {
+		Currency string       `xml:"currency,attr"`
+		Amount   Decimal      `xml:",chardata"`
+		Raw      DecimalBytes `xml:"raw,attr"`
+	}
+	type Fee struct {
+		Amount DecimalBytes `xml:",chardata"`
+	}
+	type Invoice struct {
+		XMLName  xml.Name       `xml:"invoice"`
+		Rate     Decimal        `xml:"rate,attr"`
+		Total    Decimal        `xml:"total"`
+		Discount *Decimal       `xml:"discount"`
+		Lines    []Decimal      `xml:"line"`
+		Taxes    []*Decimal     `xml:"tax"`
+		Price    Price          `xml:"price"`
+		Weights  []Decimal      `xml:"weights,attr"`
+		Codes    []DecimalBytes `xml:"code,attr=value"`
+		Subtotal Decimal        `xml:"summary>subtotal"`
+		Fee      Fee            `xml:"fee"`
+		Shipping DecimalDigits  `xml:"shipping,attr=value"`
+	}
+
+	xmlData := []byte(`<invoice rate="0.21" weights="1.5 2.25">
+		<total>1234.56</total>
+		<discount>-10.00</discount>
+		<line>10.50</line>
+		<line>0.05</line>
+		<tax>2.10</tax>
+		<price currency="EUR" raw="3.5">99.99</price>
+		<code value="7.1"/>
+		<summary><subtotal>1000</subtotal></summary>
+		<fee>1.5</fee>
+		<shipping value="4.95"/>
+	</invoice>`)
+
+	var inv Invoice
+	if err := xmlctx.Unmarshal(xmlData, &inv); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	checks := []struct {
+		name string
+		got  fmt.Stringer
+		want string
+	}{
+		{"Rate", inv.Rate, "0.21"},
+		{"Total", inv.Total, "1234.56"},
+		{"Price.Amount", inv.Price.Amount, "99.99"},
+		{"Subtotal", inv.Subtotal, "1000"},
+	}
+	for _, c := range checks {
+		if c.got.String() != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, c.got, c.want)
+		}
+	}
+	if inv.Discount == nil || inv.Discount.String() != "-10.00" {
+		t.Errorf("Discount: got %v, want -10.00", inv.Discount)
+	}
+	if len(inv.Lines) != 2 || inv.Lines[0].String() != "10.50" || inv.Lines[1].String() != "0.05" {
+		t.Errorf("Lines: got %v, want [10.50 0.05]", inv.Lines)
+	}
+	if len(inv.Taxes) != 1 || inv.Taxes[0].String() != "2.10" {
+		t.Errorf("Taxes: got %v, want [2.10]", inv.Taxes)
+	}
+	if len(inv.Weights) != 2 || inv.Weights[1].String() != "2.25" {
+		t.Errorf("Weights: got %v, want [1.5 2.25]", inv.Weights)
+	}
+	if string(inv.Price.Raw) != "D3.5" {
+		t.Errorf("Price.Raw: got %s, want D3.5", inv.Price.Raw)
+	}
+	if len(inv.Codes) != 1 || string(inv.Codes[0]) != "D7.1" {
+		t.Errorf("Codes: got %s, want [D7.1]", inv.Codes)
+	}
+	// Slice-based decimals unmarshal themselves rather than being treated
+	// as raw bytes or as lists of elements
+	if string(inv.Fee.Amount) != "D1.5" {
+		t.Errorf("Fee.Amount: got %s, want D1.5", inv.Fee.Amount)
+	}
+	if string(inv.Shipping) != "4.95" {
+		t.Errorf("Shipping: got %s, want 4.95", string(inv.Shipping))
+	}
+
+	// Root values and invalid input go through UnmarshalText too
+	total, err := xmlctx.Parse[Decimal]([]byte(`<total>5.5</total>`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if total.String() != "5.5" {
+		t.Errorf("Parse: got %s, want 5.5", total)
+	}
+	digits, err := xmlctx.Parse[DecimalDigits]([]byte(`<total>5.5</total>`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if string(digits) != "5.5" {
+		t.Errorf("Parse digits: got %s, want 5.5", string(digits))
+	}
+	if err := xmlctx.Unmarshal([]byte(`<invoice><total>1,5</total></invoice>`), &inv); err == nil {
+		t.Error("Expected error for invalid decimal, got nil")
+	}
+}
+
+// TestNetIPTypes tests decoding netip.Addr and netip.Prefix through their
+// UnmarshalText methods
+func TestNetIPTypes(t *testing.T) {
+	type Route struct {
+		XMLName  xml.Name       `xml:"route"`
+		Network  netip.Prefix   `xml:"network,attr"`
+		Gateway  netip.Addr     `xml:"gateway"`
+		Fallback *netip.Addr    `xml:"fallback"`
+		DNS      []netip.Addr   `xml:"dns"`
+		Allowed  []netip.Prefix `xml:"allowed,attr"`
+	}
+
+	xmlData := []byte(`<route network="10.0.0.0/8" allowed="192.168.0.0/16 fd00::/8">
+		<gateway> 10.0.0.1 </gateway>
+		<fallback>2001:db8::1</fallback>
+		<dns>1.1.1.1</dns>
+		<dns>2606:4700:4700::1111</dns>
+	</route>`)
+
+	var route Route
+	if err := xmlctx.Unmarshal(xmlData, &route); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if want := netip.MustParsePrefix("10.0.0.0/8"); route.Network != want {
+		t.Errorf("Network: got %v, want %v", route.Network, want)
+	}
+	if want := netip.MustParseAddr("10.0.0.1"); route.Gateway != want {
+		t.Errorf("Gateway: got %v, want %v", route.Gateway, want)
+	}
+	if want := netip.MustParseAddr("2001:db8::1"); route.Fallback == nil || *route.Fallback != want {
+		t.Errorf("Fallback: got %v, want %v", route.Fallback, want)
+	}
+	wantDNS := []netip.Addr{netip.MustParseAddr("1.1.1.1"), netip.MustParseAddr("2606:4700:4700::1111")}
+	if !reflect.DeepEqual(route.DNS, wantDNS) {
+		t.Errorf("DNS: got %v, want %v", route.DNS, wantDNS)
+	}
+	wantAllowed := []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16"), netip.MustParsePrefix("fd00::/8")}
+	if !reflect.DeepEqual(route.Allowed, wantAllowed) {
+		t.Errorf("Allowed: got %v, want %v", route.Allowed, wantAllowed)
+	}
+
+	err := xmlctx.Unmarshal([]byte(`<route><gateway>10.0.0.256</gateway></route>`), &route)
+	if err == nil {
+		t.Fatal("Expected error for invalid address, got nil")
+	}
+}
+
+// TestRootName tests peeking the root element name before choosing a target
+func TestRootName(t *testing.T) {
+	type Document struct {
+		XMLName xml.Name `xml:""`
+		ID      string   `xml:"id"`
+	}
+
+	docs := map[string]string{
+		"invoice":    `<?xml version="1.0" encoding="UTF-8"?><!-- issued --><invoice><id>INV-1</id></invoice>`,
+		"creditNote": `<creditNote><id>CN-1</id></creditNote>`,
+	}
+	for want, data := range docs {
+		dec := xmlctx.NewDecoder(strings.NewReader(data))
+		name, err := dec.RootName()
+		if err != nil {
+			t.Fatalf("RootName: %v", err)
+		}
+		if name.Local != want {
+			t.Errorf("RootName: got %s, want %s", name.Local, want)
+		}
+		// Peeking again returns the same name
+		if again, _ := dec.RootName(); again != name {
+			t.Errorf("RootName again: got %v, want %v", again, name)
+		}
+
+		var doc Document
+		if err := dec.Decode(&doc); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if doc.XMLName != name {
+			t.Errorf("XMLName: got %v, want %v", doc.XMLName, name)
+		}
+		if !strings.HasSuffix(doc.ID, "-1") {
+			t.Errorf("ID: got %s, want a -1 suffix", doc.ID)
+		}
+	}
+
+	dec := xmlctx.NewDecoder(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?><order/>`))
+	if _, err := dec.RootName(); err != nil {
+		t.Fatalf("RootName: %v", err)
+	}
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if _, encoding := dec.Declaration(); encoding != "UTF-8" {
+		t.Errorf("Declaration encoding: got %s, want UTF-8", encoding)
+	}
+
+	if _, err := xmlctx.NewDecoder(strings.NewReader("")).RootName(); !errors.Is(err, io.EOF) {
+		t.Errorf("RootName of empty input: got %v, want io.EOF", err)
+	}
+}
+
+// TestStrictNumbers tests rejecting padded numbers with WithStrictNumbers
+func TestStrictNumbers(t *testing.T) {
+	type Stock struct {
+		XMLName  xml.Name `xml:"stock"`
+		Count    int      `xml:"count"`
+		Reserved uint     `xml:"reserved,attr"`
+	}
+
+	tests := []struct {
+		name    string
+		xml     string
+		wantErr bool
+	}{
+		{"bare", `<stock reserved="2"><count>42</count></stock>`, false},
+		{"padded element", `<stock reserved="2"><count>  42  </count></stock>`, true},
+		{"padded with newline", "<stock reserved=\"2\"><count>42\n</count></stock>", true},
+		{"padded attribute", `<stock reserved=" 2"><count>42</count></stock>`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Lenient parsing trims the whitespace
+			var stock Stock
+			if err := xmlctx.Unmarshal([]byte(tt.xml), &stock); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if stock.Count != 42 || stock.Reserved != 2 {
+				t.Errorf("got Count %d and Reserved %d, want 42 and 2", stock.Count, stock.Reserved)
+			}
+
+			stock = Stock{}
+			err := xmlctx.Unmarshal([]byte(tt.xml), &stock, xmlctx.WithStrictNumbers())
+			if tt.wantErr && err == nil {
+				t.Error("Expected error for padded number, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestDedupSlice tests skipping repeated elements with the same dedup=<attr> key
+func TestDedupSlice(t *testing.T) {
+	type Tag struct {
+		ID    string `xml:"id,attr"`
+		Label string `xml:",chardata"`
+	}
+	type Post struct {
+		XMLName xml.Name `xml:"post"`
+		Tags    []Tag    `xml:"tag,dedup=id"`
+		All     []Tag    `xml:"other"`
+	}
+
+	xmlData := []byte(`<post>
+		<tag id="go">Go</tag>
+		<tag id="xml">XML</tag>
+		<tag id="go">Golang</tag>
+		<tag>Untagged</tag>
+		<tag>Untagged</tag>
+		<other id="a">A</other>
+		<other id="a">A</other>
+	</post>`)
+
+	var post Post
+	if err := xmlctx.Unmarshal(xmlData, &post); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	want := []Tag{{"go", "Go"}, {"xml", "XML"}, {"", "Untagged"}, {"", "Untagged"}}
+	if len(post.Tags) != len(want) {
+		t.Fatalf("Tags: got %v, want %v", post.Tags, want)
+	}
+	for i := range want {
+		if post.Tags[i] != want[i] {
+			t.Errorf("Tags[%d]: got %v, want %v", i, post.Tags[i], want[i])
+		}
+	}
+	if len(post.All) != 2 {
+		t.Errorf("All: got %d elements, want 2", len(post.All))
+	}
+}
+
+// TestCountFields tests counting repeated child elements into ,count fields
+func TestCountFields(t *testing.T) {
+	type Item struct {
+		ID string `xml:"id,attr"`
+	}
+	type Order struct {
+		XMLName   xml.Name `xml:"order"`
+		Items     []Item   `xml:"item,dedup=id"`
+		ItemCount int      `xml:",count=item"`
+		Notes     uint     `xml:"note,count"`
+		Gifts     *int     `xml:",count=gift"`
+	}
+
+	xmlData := []byte(`<order>
+		<item id="a"/><note>fragile</note><item id="b"/>
+		<item id="a"/><note>gift wrap</note>
+	</order>`)
+
+	var order Order
+	if err := xmlctx.Unmarshal(xmlData, &order); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	// The count includes the duplicate the slice dropped
+	if order.ItemCount != 3 || len(order.Items) != 2 {
+		t.Errorf("got ItemCount %d and %d items, want 3 and 2", order.ItemCount, len(order.Items))
+	}
+	if order.Notes != 2 {
+		t.Errorf("Notes: got %d, want 2", order.Notes)
+	}
+	if order.Gifts == nil || *order.Gifts != 0 {
+		t.Errorf("Gifts: got %v, want 0", order.Gifts)
+	}
+}
+
+// TestAtEnd tests checking for content after the decoded document
+func TestAtEnd(t *testing.T) {
+	type Ping struct {
+		XMLName xml.Name `xml:"ping"`
+		Seq     int      `xml:"seq,attr"`
+	}
+
+	tests := []struct {
+		name string
+		xml  string
+		want bool
+	}{
+		{"single document", `<ping seq="1"/>`, true},
+		{"trailing whitespace and comments", "<ping seq=\"1\"/>\n<!-- sent by probe -->\n", true},
+		{"second document", `<ping seq="1"/><ping seq="2"/>`, false},
+		{"trailing text", `<ping seq="1"/>junk`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := xmlctx.NewDecoder(strings.NewReader(tt.xml))
+			var ping Ping
+			if err := dec.Decode(&ping); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			atEnd, err := dec.AtEnd()
+			if err != nil {
+				t.Fatalf("AtEnd: %v", err)
+			}
+			if atEnd != tt.want {
+				t.Errorf("AtEnd: got %v, want %v", atEnd, tt.want)
+			}
+		})
+	}
+
+	// The peeked document can still be decoded
+	dec := xmlctx.NewDecoder(strings.NewReader(`<ping seq="1"/> <ping seq="2"/>`))
+	var ping Ping
+	if err := dec.Decode(&ping); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if atEnd, _ := dec.AtEnd(); atEnd {
+		t.Fatal("AtEnd: got true before the second document")
+	}
+	if err := dec.Decode(&ping); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if ping.Seq != 2 {
+		t.Errorf("Seq: got %d, want 2", ping.Seq)
+	}
+	if atEnd, _ := dec.AtEnd(); !atEnd {
+		t.Error("AtEnd: got false after the last document")
+	}
+}
+
+// TestRawDecoder tests reading tokens from the underlying xml.Decoder before
+// resuming namespace-aware decoding
+func TestRawDecoder(t *testing.T) {
+	type Ping struct {
+		XMLName xml.Name `xml:"p:ping"`
+		Seq     int      `xml:"p:seq,attr"`
+	}
+
+	xmlData := `<!-- probe v2 --><p:ping xmlns:p="urn:ping" p:seq="7"/>`
+	dec := xmlctx.NewDecoder(strings.NewReader(xmlData), xmlctx.WithNamespaces(map[string]string{"p": "urn:ping"}))
+
+	tok, err := dec.Raw().Token()
+	if err != nil {
+		t.Fatalf("Failed to read token: %v", err)
+	}
+	if comment, ok := tok.(xml.Comment); !ok || string(comment) != " probe v2 " {
+		t.Fatalf("first token: got %#v, want comment", tok)
+	}
+
+	var ping Ping
+	if err := dec.Decode(&ping); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if ping.Seq != 7 {
+		t.Errorf("Seq: got %d, want 7", ping.Seq)
+	}
+}
+
+// TestDecodeValue tests decoding into a prepared reflect.Value, and rejecting
+// values that cannot be set
+func TestDecodeValue(t *testing.T) {
+	type Ping struct {
+		XMLName xml.Name `xml:"p:ping"`
+		Seq     int      `xml:"p:seq,attr"`
+		Host    string   `xml:"p:host"`
+	}
+
+	xmlData := `<p:ping xmlns:p="urn:ping" p:seq="7"><p:host>example.com</p:host></p:ping>`
+	opts := []xmlctx.Option{xmlctx.WithNamespaces(map[string]string{"p": "urn:ping"})}
+
+	rv := reflect.New(reflect.TypeOf(Ping{})).Elem()
+	dec := xmlctx.NewDecoder(strings.NewReader(xmlData), opts...)
+	if err := dec.DecodeValue(rv); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	ping := rv.Interface().(Ping)
+	if ping.Seq != 7 {
+		t.Errorf("Seq: got %d, want 7", ping.Seq)
+	}
+	if ping.Host != "example.com" {
+		t.Errorf("Host: got %s, want example.com", ping.Host)
+	}
+
+	// A field of an addressable struct is settable too
+	var holder struct{ Ping Ping }
+	dec = xmlctx.NewDecoder(strings.NewReader(xmlData), opts...)
+	if err := dec.DecodeValue(reflect.ValueOf(&holder).Elem().Field(0)); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if holder.Ping.Seq != 7 {
+		t.Errorf("Ping.Seq: got %d, want 7", holder.Ping.Seq)
+	}
+
+	for name, target := range map[string]reflect.Value{
+		"unaddressable": reflect.ValueOf(Ping{}),
+		"invalid":       {},
+	} {
+		dec = xmlctx.NewDecoder(strings.NewReader(xmlData), opts...)
+		if err := dec.DecodeValue(target); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+// TestEmptyNumericPointers tests empty numeric content leaving pointers nil
+func TestEmptyNumericPointers(t *testing.T) {
+	type Reading struct {
+		XMLName  xml.Name `xml:"reading"`
+		Value    *int     `xml:"value"`
+		Count    *uint16  `xml:"count"`
+		Offset   *int     `xml:"offset,attr"`
+		Quantity *int     `xml:"quantity"`
+	}
+
+	xmlData := []byte(`<reading offset=""><value></value><count>  </count><quantity>7</quantity></reading>`)
+	var reading Reading
+	if err := xmlctx.Unmarshal(xmlData, &reading); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if reading.Value != nil {
+		t.Errorf("Value: got %d, want nil", *reading.Value)
+	}
+	if reading.Count != nil {
+		t.Errorf("Count: got %d, want nil", *reading.Count)
+	}
+	if reading.Offset != nil {
+		t.Errorf("Offset: got %d, want nil", *reading.Offset)
+	}
+	if reading.Quantity == nil || *reading.Quantity != 7 {
+		t.Errorf("Quantity: got %v, want 7", reading.Quantity)
+	}
+
+	// Non-pointer numeric fields still reject empty content
+	type Strict struct {
+		XMLName xml.Name `xml:"reading"`
+		Value   int      `xml:"value"`
+	}
+	var strict Strict
+	if err := xmlctx.Unmarshal([]byte(`<reading><value></value></reading>`), &strict); err == nil {
+		t.Error("Expected error for empty int, got nil")
+	}
+}
+
+// TestFieldHook tests the hook called with each populated field
+func TestFieldHook(t *testing.T) {
+	type Card struct {
+		Number string `xml:"number"`
+		Holder string `xml:"holder,attr"`
+	}
+	type Payment struct {
+		XMLName xml.Name `xml:"payment"`
+		ID      string   `xml:"id,attr"`
+		Amount  int      `xml:"amount"`
+		Card    Card     `xml:"card"`
+		Country string   `xml:"address>country"`
+		Notes   []string `xml:"note"`
+	}
+
+	xmlData := []byte(`<payment id="P1">
+		<amount>100</amount>
+		<card holder="Ann"><number>4111111111111111</number></card>
+		<address><country>ES</country></address>
+		<note>a</note>
+		<note>b</note>
+	</payment>`)
+
+	// Count calls per field, redacting the card number on the fly
+	calls := make(map[string]int)
+	hook := func(name string, value reflect.Value) error {
+		calls[name]++
+		if name == "Number" {
+			value.SetString("****" + value.String()[12:])
+		}
+		return nil
+	}
+	var payment Payment
+	if err := xmlctx.Unmarshal(xmlData, &payment, xmlctx.WithFieldHook(hook)); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	want := map[string]int{"ID": 1, "Amount": 1, "Holder": 1, "Number": 1, "Card": 1, "Country": 1, "Notes": 2}
+	for name, n := range want {
+		if calls[name] != n {
+			t.Errorf("calls[%s]: got %d, want %d", name, calls[name], n)
+		}
+	}
+	if len(calls) != len(want) {
+		t.Errorf("calls: got %v, want %v", calls, want)
+	}
+	if payment.Card.Number != "****1111" {
+		t.Errorf("Card.Number: got %s, want ****1111", payment.Card.Number)
+	}
+
+	// A hook error aborts decoding
+	errTooLarge := errors.New("amount too large")
+	reject := func(name string, value reflect.Value) error {
+		if name == "Amount" && value.Int() > 50 {
+			return errTooLarge
+		}
+		return nil
+	}
+	payment = Payment{}
+	err := xmlctx.Unmarshal(xmlData, &payment, xmlctx.WithFieldHook(reject))
+	if !errors.Is(err, errTooLarge) {
+		t.Fatalf("Expected hook error, got %v", err)
+	}
+	if payment.Card.Number != "" {
+		t.Errorf("Card.Number: got %s, want empty after abort", payment.Card.Number)
+	}
+}
+
+// TestHTMLEntities tests decoding HTML named entities with WithHTMLEntities
+func TestHTMLEntities(t *testing.T) {
+	type Article struct {
+		XMLName xml.Name `xml:"article"`
+		Title   string   `xml:"title,attr"`
+		Footer  string   `xml:"footer"`
+	}
+
+	xmlData := []byte(`<article title="Caf&eacute;"><footer>&copy;&nbsp;2024 &amp; beyond</footer></article>`)
+
+	var article Article
+	if err := xmlctx.Unmarshal(xmlData, &article); err == nil {
+		t.Error("Expected error for HTML entities without WithHTMLEntities, got nil")
+	}
+
+	article = Article{}
+	if err := xmlctx.Unmarshal(xmlData, &article, xmlctx.WithHTMLEntities()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if article.Footer != "©\u00a02024 & beyond" {
+		t.Errorf("Footer: got %q, want %q", article.Footer, "©\u00a02024 & beyond")
+	}
+	if article.Title != "Café" {
+		t.Errorf("Title: got %s, want Café", article.Title)
+	}
+}
+
+// TestPathSliceLeaf tests collecting every element at the end of a path into a slice field
+func TestPathSliceLeaf(t *testing.T) {
+	type Catalog struct {
+		XMLName xml.Name `xml:"catalog"`
+		Codes   []string `xml:"list>code"`
+		Name    string   `xml:"list>name"`
+	}
+
+	xmlData := []byte(`<catalog>
+		<list>
+			<code>A</code>
+			<name>First</name>
+			<code>B</code>
+			<name>Second</name>
+			<code>C</code>
+		</list>
+	</catalog>`)
+
+	var catalog Catalog
+	if err := xmlctx.Unmarshal(xmlData, &catalog); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(catalog.Codes) != 3 || catalog.Codes[0] != "A" || catalog.Codes[1] != "B" || catalog.Codes[2] != "C" {
+		t.Errorf("Codes: got %v, want [A B C]", catalog.Codes)
+	}
+	// Non-slice fields still take the first element
+	if catalog.Name != "First" {
+		t.Errorf("Name: got %s, want First", catalog.Name)
+	}
+}
+
+// TestPathSliceOfStructs tests decoding every element at the end of a path
+// into a slice of structs, the usual shape of invoice lines
+func TestPathSliceOfStructs(t *testing.T) {
+	type LineItem struct {
+		Number   int      `xml:"number,attr"`
+		Currency string   `xml:"price>@currency"`
+		Name     string   `xml:"name"`
+		Price    int      `xml:"price"`
+		Notes    []string `xml:"note"`
+	}
+	type Invoice struct {
+		XMLName xml.Name   `xml:"invoice"`
+		Lines   []LineItem `xml:"lines>line"`
+		Count   int        `xml:"lines>count"`
+	}
+
+	xmlData := []byte(`<invoice>
+		<lines>
+			<line number="1"><name>Widget</name><price currency="EUR">100</price><note>a</note><note>b</note></line>
+			<count>3</count>
+			<line number="2"><name>Gadget</name><price currency="USD">250</price></line>
+			<line number="3"><name>Gizmo</name><price currency="EUR">75</price><note>c</note></line>
+		</lines>
+	</invoice>`)
+
+	var inv Invoice
+	if err := xmlctx.Unmarshal(xmlData, &inv); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	want := []LineItem{
+		{Number: 1, Currency: "EUR", Name: "Widget", Price: 100, Notes: []string{"a", "b"}},
+		{Number: 2, Currency: "USD", Name: "Gadget", Price: 250},
+		{Number: 3, Currency: "EUR", Name: "Gizmo", Price: 75, Notes: []string{"c"}},
+	}
+	if !reflect.DeepEqual(inv.Lines, want) {
+		t.Errorf("Lines: got %+v, want %+v", inv.Lines, want)
+	}
+	if inv.Count != 3 {
+		t.Errorf("Count: got %d, want 3", inv.Count)
+	}
+}
+
+// Counter is a lock-free counter that sets itself from XML text
+type Counter struct {
+	n atomic.Int64
+}
+
+// SetXML implements xmlctx.XMLSetter
+func (c *Counter) SetXML(text string) error {
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("counter: %w", err)
+	}
+	c.n.Store(n)
+	return nil
+}
+
+// TestXMLSetter tests populating fields through their SetXML method
+func TestXMLSetter(t *testing.T) {
+	type Stats struct {
+		XMLName xml.Name   `xml:"stats"`
+		Hits    Counter    `xml:"hits"`
+		Misses  *Counter   `xml:"misses,attr"`
+		Shards  []*Counter `xml:"shard"`
+	}
+
+	xmlData := []byte(`<stats misses="3">
+		<hits>
+			42
+		</hits>
+		<shard>1</shard>
+		<shard>2</shard>
+	</stats>`)
+
+	var stats Stats
+	if err := xmlctx.Unmarshal(xmlData, &stats); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if got := stats.Hits.n.Load(); got != 42 {
+		t.Errorf("Hits: got %d, want 42", got)
+	}
+	if stats.Misses == nil || stats.Misses.n.Load() != 3 {
+		t.Errorf("Misses: got %v, want 3", stats.Misses)
+	}
+	if len(stats.Shards) != 2 || stats.Shards[1].n.Load() != 2 {
+		t.Errorf("Shards: got %d shards, want 2", len(stats.Shards))
+	}
+
+	err := xmlctx.Unmarshal([]byte(`<stats><hits>many</hits></stats>`), &stats)
+	if err == nil || !strings.Contains(err.Error(), "counter:") {
+		t.Errorf("Expected error from SetXML, got %v", err)
+	}
+}
+
+// JSONStatus has an UnmarshalText meant for JSON, which expects quoted text
+type JSONStatus string
+
+// UnmarshalText requires the quotes of a JSON string
+func (s *JSONStatus) UnmarshalText(text []byte) error {
+	unquoted, err := strconv.Unquote(string(text))
+	if err != nil {
+		return fmt.Errorf("status %s is not a JSON string", text)
+	}
+	*s = JSONStatus(unquoted)
+	return nil
+}
+
+// TestWithoutTextUnmarshaler tests ignoring UnmarshalText for excluded types
+func TestWithoutTextUnmarshaler(t *testing.T) {
+	type Order struct {
+		XMLName  xml.Name     `xml:"order"`
+		Status   JSONStatus   `xml:"status"`
+		Previous *JSONStatus  `xml:"previous,attr"`
+		History  []JSONStatus `xml:"history>status"`
+	}
+
+	xmlData := []byte(`<order previous="open"><status>shipped</status><history><status>open</status></history></order>`)
+
+	var order Order
+	if err := xmlctx.Unmarshal(xmlData, &order); err == nil {
+		t.Error("Expected error from UnmarshalText, got nil")
+	}
+
+	order = Order{}
+	err := xmlctx.Unmarshal(xmlData, &order, xmlctx.WithoutTextUnmarshaler(reflect.TypeFor[JSONStatus]()))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if order.Status != "shipped" {
+		t.Errorf("Status: got %s, want shipped", order.Status)
+	}
+	if order.Previous == nil || *order.Previous != "open" {
+		t.Errorf("Previous: got %v, want open", order.Previous)
+	}
+	if len(order.History) != 1 || order.History[0] != "open" {
+		t.Errorf("History: got %v, want [open]", order.History)
+	}
+}
+
+// TestListElements tests splitting an element's text into a slice with ,list
+func TestListElements(t *testing.T) {
+	type Box struct {
+		XMLName    xml.Name `xml:"box"`
+		Dimensions []int    `xml:"dimensions,list"`
+		Labels     []string `xml:"labels,list"`
+		Sizes      []string `xml:"size"`
+	}
+
+	xmlData := []byte(`<box>
+		<dimensions>10 20
+			30</dimensions>
+		<labels>fragile  this-side-up</labels>
+		<size>small medium</size>
+	</box>`)
+
+	var box Box
+	if err := xmlctx.Unmarshal(xmlData, &box); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(box.Dimensions) != 3 || box.Dimensions[0] != 10 || box.Dimensions[1] != 20 || box.Dimensions[2] != 30 {
+		t.Errorf("Dimensions: got %v, want [10 20 30]", box.Dimensions)
+	}
+	if len(box.Labels) != 2 || box.Labels[0] != "fragile" || box.Labels[1] != "this-side-up" {
+		t.Errorf("Labels: got %v, want [fragile this-side-up]", box.Labels)
+	}
+	// Without ,list each element is one slice item
+	if len(box.Sizes) != 1 || box.Sizes[0] != "small medium" {
+		t.Errorf("Sizes: got %v, want [small medium]", box.Sizes)
+	}
+
+	box = Box{}
+	err := xmlctx.Unmarshal([]byte(`<box><dimensions>10 twenty 30</dimensions></box>`), &box)
+	if err == nil {
+		t.Fatal("Expected error for bad list item, got nil")
+	}
+	if !strings.Contains(err.Error(), `"twenty"`) {
+		t.Errorf("Error should name the bad item, got: %v", err)
+	}
+}
+
+// TestTokenStrings tests collapsing whitespace in ,token strings like xs:token
+func TestTokenStrings(t *testing.T) {
+	type Item struct {
+		XMLName xml.Name `xml:"item"`
+		Kind    string   `xml:"kind,attr,token"`
+		Code    string   `xml:"code,token"`
+		Name    string   `xml:"name"`
+	}
+
+	xmlData := []byte("<item kind=\" x  y \"><code>  a   b  </code><name>  a   b  </name></item>")
+
+	var item Item
+	if err := xmlctx.Unmarshal(xmlData, &item); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if item.Code != "a b" {
+		t.Errorf("Code: got %q, want \"a b\"", item.Code)
+	}
+	if item.Kind != "x y" {
+		t.Errorf("Kind: got %q, want \"x y\"", item.Kind)
+	}
+	// Without ,token only the ends are trimmed
+	if item.Name != "a   b" {
+		t.Errorf("Name: got %q, want \"a   b\"", item.Name)
+	}
+
+	item = Item{}
+	if err := xmlctx.Unmarshal([]byte("<item><code>\n\tline\n\tbreak\n</code></item>"), &item); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if item.Code != "line break" {
+		t.Errorf("Code: got %q, want \"line break\"", item.Code)
+	}
+}
+
+// TestCharFields tests decoding single characters into rune and byte fields
+// as their code points with ,char
+func TestCharFields(t *testing.T) {
+	type Person struct {
+		XMLName   xml.Name `xml:"person"`
+		Initial   rune     `xml:"initial,char"`
+		Grade     byte     `xml:"grade,attr,char"`
+		Separator rune     `xml:"sep,attr,char"`
+		Age       int32    `xml:"age"`
+	}
+
+	xmlData := []byte(`<person grade="B" sep=" "><initial> É </initial><age>41</age></person>`)
+
+	var person Person
+	if err := xmlctx.Unmarshal(xmlData, &person); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if person.Initial != 'É' {
+		t.Errorf("Initial: got %q, want 'É'", person.Initial)
+	}
+	if person.Grade != 'B' {
+		t.Errorf("Grade: got %q, want 'B'", person.Grade)
+	}
+	if person.Separator != ' ' {
+		t.Errorf("Separator: got %q, want ' '", person.Separator)
+	}
+	// Without ,char runes are numbers
+	if person.Age != 41 {
+		t.Errorf("Age: got %d, want 41", person.Age)
+	}
+
+	for _, bad := range []string{
+		`<person><initial>AB</initial></person>`,
+		`<person><initial></initial></person>`,
+		`<person grade="€"/>`,
+	} {
+		person = Person{}
+		if err := xmlctx.Unmarshal([]byte(bad), &person); err == nil {
+			t.Errorf("Expected error for %s, got nil", bad)
+		}
+	}
+}
+
+// TestTimeAndDurationAttributes tests decoding timestamps and durations from attributes and elements
+func TestTimeAndDurationAttributes(t *testing.T) {
+	type Cache struct {
+		XMLName  xml.Name       `xml:"cache"`
+		TTL      time.Duration  `xml:"ttl,attr"`
+		Expires  time.Time      `xml:"expires,attr"`
+		Grace    *time.Duration `xml:"grace,attr"`
+		Purged   *time.Time     `xml:"purged,attr"`
+		Interval time.Duration  `xml:"interval"`
+	}
+
+	xmlData := []byte(`<cache ttl="30m" expires="2024-01-15T00:00:00Z"><interval>1h30m</interval></cache>`)
+
+	var cache Cache
+	if err := xmlctx.Unmarshal(xmlData, &cache); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if cache.TTL != 30*time.Minute {
+		t.Errorf("TTL: got %v, want 30m", cache.TTL)
+	}
+	if want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC); !cache.Expires.Equal(want) {
+		t.Errorf("Expires: got %v, want %v", cache.Expires, want)
+	}
+	if cache.Interval != 90*time.Minute {
+		t.Errorf("Interval: got %v, want 1h30m", cache.Interval)
+	}
+	// Absent attributes leave pointers nil
+	if cache.Grace != nil {
+		t.Errorf("Grace: got %v, want nil", *cache.Grace)
+	}
+	if cache.Purged != nil {
+		t.Errorf("Purged: got %v, want nil", *cache.Purged)
+	}
+
+	cache = Cache{}
+	if err := xmlctx.Unmarshal([]byte(`<cache grace="5s" purged="2024-02-01T10:00:00+01:00"/>`), &cache); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if cache.Grace == nil || *cache.Grace != 5*time.Second {
+		t.Errorf("Grace: got %v, want 5s", cache.Grace)
+	}
+	if cache.Purged == nil || cache.Purged.Hour() != 10 {
+		t.Errorf("Purged: got %v, want 10:00 +01:00", cache.Purged)
+	}
+
+	// Plain integers are nanoseconds, in elements and attributes
+	cache = Cache{}
+	if err := xmlctx.Unmarshal([]byte(`<cache ttl="1000000000"><interval> 2000000000 </interval></cache>`), &cache); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if cache.TTL != time.Second {
+		t.Errorf("TTL: got %v, want 1s", cache.TTL)
+	}
+	if cache.Interval != 2*time.Second {
+		t.Errorf("Interval: got %v, want 2s", cache.Interval)
+	}
+
+	if err := xmlctx.Unmarshal([]byte(`<cache ttl="soon"/>`), &cache); err == nil {
+		t.Error("Expected error for invalid duration, got nil")
+	}
+}
+
+// TestDecodeGeneric tests decoding a document into the generic tree
+func TestDecodeGeneric(t *testing.T) {
+	namespaces := map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+		"ns2": NS2URL,
+	}
+	decodeFile := func(path string) map[string]any {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		tree, err := xmlctx.NewDecoder(strings.NewReader(string(data)), xmlctx.WithNamespaces(namespaces)).DecodeGeneric()
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", path, err)
+		}
+		return tree
+	}
+
+	tree := decodeFile("testdata/01_explicit_prefixes.xml")
+	if len(tree) != 1 {
+		t.Fatalf("tree: got %d roots, want 1", len(tree))
+	}
+	user, ok := tree["user"].(map[string]any)
+	if !ok {
+		t.Fatalf("user: got %T, want map[string]any", tree["user"])
+	}
+
+	wantAttrs := map[string]any{"id": "user-123", "version": "1.0"}
+	if !reflect.DeepEqual(user[xmlctx.GenericAttrsKey], wantAttrs) {
+		t.Errorf("user attributes: got %v, want %v", user[xmlctx.GenericAttrsKey], wantAttrs)
+	}
+	if _, ok := user[xmlctx.GenericTextKey]; ok {
+		t.Errorf("user text: got %v, want none", user[xmlctx.GenericTextKey])
+	}
+	for _, key := range []string{"name", "email", "ns1:profile", "ns1:settings", "ns2:address", "ns2:metadata"} {
+		if _, ok := user[key].([]any); !ok {
+			t.Errorf("user[%s]: got %T, want []any", key, user[key])
+		}
+	}
+
+	name := user["name"].([]any)[0].(map[string]any)
+	if name[xmlctx.GenericTextKey] != "John Doe" {
+		t.Errorf("name text: got %v, want John Doe", name[xmlctx.GenericTextKey])
+	}
+	profile := user["ns1:profile"].([]any)[0].(map[string]any)
+	if tags := profile["ns1:tag"].([]any); len(tags) != 3 {
+		t.Errorf("ns1:tag: got %d elements, want 3", len(tags))
+	}
+	wantProfileAttrs := map[string]any{"visibility": "public", "verified": "true"}
+	if !reflect.DeepEqual(profile[xmlctx.GenericAttrsKey], wantProfileAttrs) {
+		t.Errorf("profile attributes: got %v, want %v", profile[xmlctx.GenericAttrsKey], wantProfileAttrs)
+	}
+
+	// Documents differing only in their prefixes decode identically
+	if other := decodeFile("testdata/02_different_prefix_names.xml"); !reflect.DeepEqual(tree, other) {
+		t.Error("Documents with different prefixes should decode to the same tree")
+	}
+
+	// Namespaces missing from the map use Clark notation
+	tree, err := xmlctx.NewDecoder(strings.NewReader(`<a xmlns:x="http://example.com/x" x:id="1"><x:b/></a>`)).DecodeGeneric()
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	want := map[string]any{"a": map[string]any{
+		xmlctx.GenericAttrsKey:    map[string]any{"{http://example.com/x}id": "1"},
+		"{http://example.com/x}b": []any{map[string]any{}},
+	}}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("tree: got %v, want %v", tree, want)
+	}
+}
+
+// TestDisallowDuplicates tests rejecting repeated elements for scalar fields
+func TestDisallowDuplicates(t *testing.T) {
+	type Contact struct {
+		XMLName xml.Name `xml:"contact"`
+		Email   string   `xml:"email"`
+		Phones  []string `xml:"phone"`
+	}
+
+	valid := []byte(`<contact><email>a@example.com</email><phone>1</phone><phone>2</phone></contact>`)
+	duplicated := []byte(`<contact><email>a@example.com</email><phone>1</phone><email>b@example.com</email></contact>`)
+
+	var contact Contact
+	if err := xmlctx.Unmarshal(valid, &contact, xmlctx.WithDisallowDuplicates()); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(contact.Phones) != 2 {
+		t.Errorf("Phones: got %d, want 2", len(contact.Phones))
+	}
+
+	// By default the later element overwrites the earlier one
+	contact = Contact{}
+	if err := xmlctx.Unmarshal(duplicated, &contact); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if contact.Email != "b@example.com" {
+		t.Errorf("Email: got %s, want b@example.com", contact.Email)
+	}
+
+	contact = Contact{}
+	err := xmlctx.Unmarshal(duplicated, &contact, xmlctx.WithDisallowDuplicates())
+	if err == nil {
+		t.Fatal("Expected error for duplicate element, got nil")
+	}
+	if !strings.Contains(err.Error(), "second occurrence of <email>") {
+		t.Errorf("Error should name the occurrence, got: %v", err)
+	}
+}
+
+// TestFirstWins tests keeping the first of repeated elements for single-valued
+// fields with WithFirstWins
+func TestFirstWins(t *testing.T) {
+	type Item struct {
+		SKU string `xml:"sku,attr"`
+	}
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		Item    Item     `xml:"item"`
+		Note    string   `xml:"note"`
+		Tags    []string `xml:"tag"`
+	}
+
+	tests := []struct {
+		name string
+		xml  string
+		item string
+		note string
+		tags int
+	}{
+		{"single", `<order><item sku="A"/><note>one</note><tag>x</tag></order>`, "A", "one", 1},
+		{"multiple", `<order><item sku="A"/><note>one</note><tag>x</tag><item sku="B"/><note>two</note><tag>y</tag></order>`, "A", "one", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, opts := range [][]xmlctx.Option{
+				{xmlctx.WithFirstWins()},
+				// First wins takes precedence over rejecting duplicates
+				{xmlctx.WithFirstWins(), xmlctx.WithDisallowDuplicates()},
+			} {
+				var order Order
+				if err := xmlctx.Unmarshal([]byte(tt.xml), &order, opts...); err != nil {
+					t.Fatalf("Failed to unmarshal: %v", err)
+				}
+				if order.Item.SKU != tt.item {
+					t.Errorf("Item: got %s, want %s", order.Item.SKU, tt.item)
+				}
+				if order.Note != tt.note {
+					t.Errorf("Note: got %s, want %s", order.Note, tt.note)
+				}
+				// Slices still take every element
+				if len(order.Tags) != tt.tags {
+					t.Errorf("Tags: got %d, want %d", len(order.Tags), tt.tags)
+				}
+			}
+		})
+	}
+}
+
+// TestAttributePrefixStruct tests routing dotted attributes into a nested struct
+func TestAttributePrefixStruct(t *testing.T) {
+	type Addr struct {
+		City string `xml:"city,attr"`
+		Zip  int    `xml:"zip,attr"`
+	}
+	type Customer struct {
+		XMLName xml.Name   `xml:"customer"`
+		Name    string     `xml:"name,attr"`
+		Addr    Addr       `xml:"addr.,attr-prefix"`
+		Billing *Addr      `xml:"billing.,attr-prefix"`
+		Other   *Addr      `xml:"other.,attr-prefix"`
+		Extra   []xml.Attr `xml:",any,attr"`
+	}
+
+	xmlData := []byte(`<customer name="Ann" addr.city="SF" addr.zip="94102" billing.city="LA" note="vip"/>`)
+
+	var customer Customer
+	if err := xmlctx.Unmarshal(xmlData, &customer); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if customer.Name != "Ann" {
+		t.Errorf("Name: got %s, want Ann", customer.Name)
+	}
+	if customer.Addr.City != "SF" || customer.Addr.Zip != 94102 {
+		t.Errorf("Addr: got %+v, want {SF 94102}", customer.Addr)
+	}
+	if customer.Billing == nil || customer.Billing.City != "LA" {
+		t.Errorf("Billing: got %+v, want {LA 0}", customer.Billing)
+	}
+	if customer.Other != nil {
+		t.Errorf("Other: got %+v, want nil", customer.Other)
+	}
+	// Routed attributes don't reach the catch-all
+	if len(customer.Extra) != 1 || customer.Extra[0].Name.Local != "note" {
+		t.Errorf("Extra: got %v, want only note", customer.Extra)
+	}
+}
+
+// TestDecodeRootAttrs tests reading only the root element's attributes
+func TestDecodeRootAttrs(t *testing.T) {
+	type Header struct {
+		XMLName xml.Name `xml:"user"`
+		ID      string   `xml:"id,attr"`
+		Version string   `xml:"version,attr"`
+		Name    string   `xml:"name"`
+	}
+
+	data, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	// Truncate the body to show it is never read
+	data = data[:strings.Index(string(data), "<name>")+len("<name>Jo")]
+
+	var header Header
+	dec := xmlctx.NewDecoder(strings.NewReader(string(data)))
+	if err := dec.DecodeRootAttrs(&header); err != nil {
+		t.Fatalf("DecodeRootAttrs: %v", err)
+	}
+	if header.ID != "user-123" {
+		t.Errorf("ID: got %s, want user-123", header.ID)
+	}
+	if header.Version != "1.0" {
+		t.Errorf("Version: got %s, want 1.0", header.Version)
+	}
+	if header.XMLName.Space != DefaultNS || header.XMLName.Local != "user" {
+		t.Errorf("XMLName: got %v, want {%s user}", header.XMLName, DefaultNS)
+	}
+	if header.Name != "" {
+		t.Errorf("Name: got %s, want empty", header.Name)
+	}
+	if _, encoding := dec.Declaration(); encoding != "UTF-8" {
+		t.Errorf("Declaration encoding: got %s, want UTF-8", encoding)
+	}
+}
+
+// TestNumericCharDataWithChild tests numeric chardata alongside a child element
+func TestNumericCharDataWithChild(t *testing.T) {
+	type Measure struct {
+		Value int    `xml:",chardata"`
+		Unit  string `xml:"uom"`
+	}
+	type Parcel struct {
+		XMLName xml.Name `xml:"parcel"`
+		Weight  Measure  `xml:"measure"`
+		Length  Measure  `xml:"length"`
+	}
+
+	xmlData := []byte(`<parcel>
+		<measure>42<uom>kg</uom></measure>
+		<length><uom>cm</uom> 120 </length>
+	</parcel>`)
+
+	var parcel Parcel
+	if err := xmlctx.Unmarshal(xmlData, &parcel); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if parcel.Weight.Value != 42 || parcel.Weight.Unit != "kg" {
+		t.Errorf("Weight: got %+v, want {42 kg}", parcel.Weight)
+	}
+	if parcel.Length.Value != 120 || parcel.Length.Unit != "cm" {
+		t.Errorf("Length: got %+v, want {120 cm}", parcel.Length)
+	}
+}
+
+// TestSliceGrowHint tests pre-growing slices with WithSliceGrowHint
+func TestSliceGrowHint(t *testing.T) {
+	type Items struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []int    `xml:"item"`
+	}
+
+	xmlData := []byte(`<items><item>1</item><item>2</item><item>3</item></items>`)
+
+	var items Items
+	if err := xmlctx.Unmarshal(xmlData, &items, xmlctx.WithSliceGrowHint(64)); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(items.Items) != 3 || items.Items[2] != 3 {
+		t.Errorf("Items: got %v, want [1 2 3]", items.Items)
+	}
+	if cap(items.Items) != 64 {
+		t.Errorf("Items capacity: got %d, want 64", cap(items.Items))
+	}
+}
+
+// TestPresenceFlags tests bool fields set by the presence of an element
+func TestPresenceFlags(t *testing.T) {
+	type Account struct {
+		XMLName  xml.Name `xml:"account"`
+		Verified bool     `xml:"verified,presence"`
+		Locked   bool     `xml:"locked,presence"`
+		Admin    bool     `xml:"admin,presence"`
+	}
+
+	xmlData := []byte(`<account><verified/><admin>false</admin></account>`)
+
+	var account Account
+	if err := xmlctx.Unmarshal(xmlData, &account); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !account.Verified {
+		t.Error("Verified: got false, want true")
+	}
+	if account.Locked {
+		t.Error("Locked: got true, want false")
+	}
+	// Presence wins over content
+	if !account.Admin {
+		t.Error("Admin: got false, want true")
+	}
+
+	// *bool fields are nil when the element is absent
+	type Flags struct {
+		XMLName  xml.Name `xml:"flags"`
+		Verified *bool    `xml:"verified,presence"`
+		Locked   *bool    `xml:"locked,presence"`
+	}
+	var flags Flags
+	if err := xmlctx.Unmarshal([]byte(`<flags><verified/></flags>`), &flags); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if flags.Verified == nil || !*flags.Verified {
+		t.Errorf("Verified: got %v, want true", flags.Verified)
+	}
+	if flags.Locked != nil {
+		t.Errorf("Locked: got %v, want nil", *flags.Locked)
+	}
+
+	// Other types can't take the option
+	type Invalid struct {
+		XMLName  xml.Name `xml:"flags"`
+		Verified string   `xml:"verified,presence"`
+	}
+	var invalid Invalid
+	err := xmlctx.Unmarshal([]byte(`<flags><verified/></flags>`), &invalid)
+	if err == nil || !strings.Contains(err.Error(), "presence option") {
+		t.Errorf("Expected presence option error, got %v", err)
+	}
+}
+
+// TestConfigConcurrentUse tests sharing one Config across goroutines
+func TestConfigConcurrentUse(t *testing.T) {
+	namespaces := map[string]string{
+		"":    DefaultNS,
+		"ns1": NS1URL,
+		"ns2": NS2URL,
+	}
+	config := xmlctx.NewConfig(
+		xmlctx.WithNamespaces(namespaces),
+		xmlctx.WithStringInterning(),
+		xmlctx.WithHTMLEntities(),
+	)
+	// Changing the caller's map afterwards doesn't affect the config
+	namespaces["ns1"] = "http://example.com/other"
+
+	data, err := os.ReadFile("testdata/01_explicit_prefixes.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	const workers = 8
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			for j := 0; j < 20; j++ {
+				var user User
+				if err := config.Unmarshal(data, &user); err != nil {
+					errs <- err
+					return
+				}
+				if user.Profile.Bio != "Software engineer and open source enthusiast" {
+					errs <- fmt.Errorf("worker %d: Profile.Bio: got %q", i, user.Profile.Bio)
+					return
+				}
+				type Note struct {
+					Text string `xml:",chardata"`
+				}
+				var note Note
+				dec := config.NewDecoder(strings.NewReader(fmt.Sprintf("<note>%d&nbsp;&copy;</note>", i)))
+				if err := dec.Decode(&note); err != nil {
+					errs <- err
+					return
+				}
+				if want := fmt.Sprintf("%d\u00a0©", i); note.Text != want {
+					errs <- fmt.Errorf("worker %d: Text: got %q, want %q", i, note.Text, want)
+					return
+				}
+			}
+			errs <- nil
+		}(i)
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestPoolNoContamination tests that pooled decoders carry no state from one
+// document to the next
+func TestPoolNoContamination(t *testing.T) {
+	type Message struct {
+		XMLName xml.Name `xml:"msg"`
+		ID      string   `xml:"id,attr"`
+		Body    string   `xml:"ext:body"`
+		Tags    []string `xml:"tag"`
+	}
+
+	pool := xmlctx.NewPool(xmlctx.WithNamespacesFromDocument())
+
+	var first Message
+	if err := pool.Unmarshal([]byte(`<msg id="a" xmlns:ext="urn:ext"><ext:body>hello</ext:body><tag>x</tag></msg>`), &first); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if first.Body != "hello" {
+		t.Errorf("Body: got %q, want hello", first.Body)
+	}
+
+	// The ext mapping seeded from the first document is gone
+	var second Message
+	if err := pool.Unmarshal([]byte(`<msg id="b" xmlns="urn:ext"><body>stray</body></msg>`), &second); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if second.ID != "b" || second.Body != "" || second.Tags != nil {
+		t.Errorf("got %+v, want only ID b", second)
+	}
+
+	const workers = 50
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			id := strconv.Itoa(i)
+			xmlData := `<msg id="` + id + `" xmlns:ext="urn:` + id + `"><ext:body>` + id + `</ext:body>` + strings.Repeat("<tag>t</tag>", i) + `</msg>`
+			var msg Message
+			if err := pool.Unmarshal([]byte(xmlData), &msg); err != nil {
+				errs <- err
+				return
+			}
+			if msg.ID != id || msg.Body != id || len(msg.Tags) != i {
+				errs <- fmt.Errorf("message %s: got %+v", id, msg)
+				return
+			}
+			errs <- nil
+		}(i)
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestScaledAmounts tests applying a scale attribute to decimal text
+func TestScaledAmounts(t *testing.T) {
+	type Amount struct {
+		Currency string  `xml:"currency,attr"`
+		Value    Decimal `xml:",chardata,scale=scale"`
+	}
+	type Payment struct {
+		XMLName  xml.Name `xml:"payment"`
+		Amount   Amount   `xml:"amount"`
+		Fee      string   `xml:"fee,scale=exp"`
+		Units    int      `xml:"units,scale=exp"`
+		Discount *Decimal `xml:"discount,scale=scale"`
+		Tax      string   `xml:"tax,scale=scale"`
+	}
+
+	xmlData := []byte(`<payment>
+		<amount currency="EUR" scale="2">1999</amount>
+		<fee exp="3">-5</fee>
+		<units exp="-2">12</units>
+		<discount scale="1">2.5</discount>
+		<tax>7.5</tax>
+	</payment>`)
+
+	var payment Payment
+	if err := xmlctx.Unmarshal(xmlData, &payment); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if payment.Amount.Value.String() != "19.99" || payment.Amount.Currency != "EUR" {
+		t.Errorf("Amount: got %s %s, want 19.99 EUR", payment.Amount.Value, payment.Amount.Currency)
+	}
+	if payment.Fee != "-0.005" {
+		t.Errorf("Fee: got %s, want -0.005", payment.Fee)
+	}
+	if payment.Units != 1200 {
+		t.Errorf("Units: got %d, want 1200", payment.Units)
+	}
+	if payment.Discount == nil || payment.Discount.String() != "0.25" {
+		t.Errorf("Discount: got %v, want 0.25", payment.Discount)
+	}
+	// Without the scale attribute the text is used as is
+	if payment.Tax != "7.5" {
+		t.Errorf("Tax: got %s, want 7.5", payment.Tax)
+	}
+
+	// Float fields parse the shifted text, within float precision
+	type FloatAmount struct {
+		Currency string  `xml:"currency,attr"`
+		Value    float64 `xml:",chardata,scale=scale"`
+	}
+	amount, err := xmlctx.Parse[FloatAmount]([]byte(`<amount currency="USD" scale="2">1999</amount>`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if amount.Value != 19.99 || amount.Currency != "USD" {
+		t.Errorf("FloatAmount: got %v %s, want 19.99 USD", amount.Value, amount.Currency)
+	}
+
+	for _, bad := range []string{
+		`<payment><amount scale="two">1999</amount></payment>`,
+		`<payment><amount scale="2">19,99</amount></payment>`,
+	} {
+		payment = Payment{}
+		if err := xmlctx.Unmarshal([]byte(bad), &payment); err == nil {
+			t.Errorf("Expected error for %s, got nil", bad)
+		}
+	}
+
+	// Scales from the document are bounded, rather than padding the number
+	// with any count of zeros
+	for _, huge := range []string{
+		`<payment><amount scale="-200000000">1999</amount></payment>`,
+		`<payment><amount scale="-9223372036854775808">1999</amount></payment>`,
+		`<payment><fee exp="101">5</fee></payment>`,
+	} {
+		payment = Payment{}
+		err := xmlctx.Unmarshal([]byte(huge), &payment)
+		var decodeErr *xmlctx.DecodeError
+		if !errors.As(err, &decodeErr) || !strings.Contains(err.Error(), "outside the range") {
+			t.Errorf("Expected out of range DecodeError for %s, got %v", huge, err)
+		}
+	}
+}
+
+// TestPathNamespaceMismatchedSegment tests that a path doesn't match through a
+// child in the wrong namespace
+func TestPathNamespaceMismatchedSegment(t *testing.T) {
+	type Doc struct {
+		XMLName xml.Name `xml:"doc"`
+		B       string   `xml:"ns1:a>ns1:b"`
+		C       string   `xml:"ns1:a>ns2:c"`
+		Next    string   `xml:"next"`
+	}
+
+	xmlData := []byte(`<doc xmlns:x="http://example.com/ns1" xmlns:y="http://example.com/ns2">
+		<x:a>
+			<y:b>wrong namespace</y:b>
+			<y:c>right namespace</y:c>
+		</x:a>
+		<next>after</next>
+	</doc>`)
+
+	var doc Doc
+	err := xmlctx.Unmarshal(xmlData, &doc, xmlctx.WithNamespaces(map[string]string{
+		"ns1": "http://example.com/ns1",
+		"ns2": "http://example.com/ns2",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if doc.B != "" {
+		t.Errorf("B: got %q, want empty", doc.B)
+	}
+	if doc.C != "right namespace" {
+		t.Errorf("C: got %q, want right namespace", doc.C)
+	}
+	// The mismatched element is skipped without consuming what follows
+	if doc.Next != "after" {
+		t.Errorf("Next: got %q, want after", doc.Next)
+	}
+}
+
+// TestEscapedColonNames tests tags naming elements and attributes whose names
+// contain a colon that isn't a namespace prefix
+func TestEscapedColonNames(t *testing.T) {
+	type Doc struct {
+		XMLName  xml.Name `xml:"doc"`
+		Kind     string   `xml:"ext\\:kind,attr"`
+		Code     string   `xml:"ext\\:code"`
+		Prefixed string   `xml:"ext:code"`
+		Odd      string   `xml:"\\:odd"`
+		Nested   string   `xml:"meta>ext\\:note"`
+	}
+
+	xmlData := []byte(`<doc ext:kind="k">
+		<ext:code>C1</ext:code>
+		<:odd>O</:odd>
+		<meta><ext:note>N</ext:note></meta>
+	</doc>`)
+
+	var doc Doc
+	if err := xmlctx.Unmarshal(xmlData, &doc); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if doc.Kind != "k" {
+		t.Errorf("Kind: got %s, want k", doc.Kind)
+	}
+	if doc.Code != "C1" {
+		t.Errorf("Code: got %s, want C1", doc.Code)
+	}
+	// The unescaped tag needs ext in the namespace map
+	if doc.Prefixed != "" {
+		t.Errorf("Prefixed: got %s, want empty", doc.Prefixed)
+	}
+	if doc.Odd != "O" {
+		t.Errorf("Odd: got %s, want O", doc.Odd)
+	}
+	if doc.Nested != "N" {
+		t.Errorf("Nested: got %s, want N", doc.Nested)
+	}
+}
+
+// TestDefaultValues tests default=<value> options filling fields whose element
+// is absent, while present elements keep their values
+func TestDefaultValues(t *testing.T) {
+	type Settings struct {
+		XMLName xml.Name `xml:"settings"`
+		Theme   string   `xml:"theme,default=light"`
+		Font    string   `xml:"font,default=serif"`
+		Size    int      `xml:"size,default=12"`
+		Retries *int     `xml:"retries,default=3"`
+		Beta    bool     `xml:"beta,default=true"`
+		Scale   float64  `xml:"scale,default=1.5"`
+		Notes   string   `xml:"notes,default=none"`
+	}
+
+	xmlData := []byte(`<settings>
+		<theme>dark</theme>
+		<size>14</size>
+		<beta>false</beta>
+		<notes></notes>
+	</settings>`)
+
+	var s Settings
+	if err := xmlctx.Unmarshal(xmlData, &s); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if s.Theme != "dark" {
+		t.Errorf("Theme: got %s, want dark", s.Theme)
+	}
+	if s.Font != "serif" {
+		t.Errorf("Font: got %s, want serif", s.Font)
+	}
+	if s.Size != 14 {
+		t.Errorf("Size: got %d, want 14", s.Size)
+	}
+	if s.Retries == nil || *s.Retries != 3 {
+		t.Errorf("Retries: got %v, want 3", s.Retries)
+	}
+	if s.Beta {
+		t.Error("Beta: got true, want false")
+	}
+	if s.Scale != 1.5 {
+		t.Errorf("Scale: got %v, want 1.5", s.Scale)
+	}
+	// A present but empty element is not absent
+	if s.Notes != "" {
+		t.Errorf("Notes: got %s, want empty", s.Notes)
+	}
+
+	type Invalid struct {
+		XMLName xml.Name `xml:"settings"`
+		Size    int      `xml:"size,default=large"`
+	}
+	var invalid Invalid
+	err := xmlctx.Unmarshal([]byte(`<settings/>`), &invalid)
+	if err == nil || strings.Count(err.Error(), "Size") != 1 {
+		t.Errorf("Expected error naming field Size once, got %v", err)
+	}
+
+	type Unsupported struct {
+		XMLName xml.Name   `xml:"settings"`
+		Gain    complex128 `xml:"gain,default=1"`
+	}
+	var unsupported Unsupported
+	err = xmlctx.Unmarshal([]byte(`<settings/>`), &unsupported)
+	if err == nil || strings.Count(err.Error(), "Gain") != 1 {
+		t.Errorf("Expected error naming field Gain once, got %v", err)
+	}
+}
+
+// TestIntegerBase tests base=N options parsing integers of attributes,
+// elements, pointers, and slices in a fixed base, or detecting it from a
+// prefix with base 0
+func TestIntegerBase(t *testing.T) {
+	type Inner struct {
+		Code int `xml:"code"`
+	}
+	type Device struct {
+		XMLName xml.Name `xml:"device"`
+		ID      int      `xml:"id,attr,base=16"`
+		Flags   uint8    `xml:"flags,attr,base=2"`
+		Mode    uint32   `xml:"mode,base=8"`
+		Serial  *int64   `xml:"serial,base=0"`
+		Ports   []uint16 `xml:"port,base=0"`
+		Mask    uint     `xml:"mask,base=0,default=0xff"`
+		Count   int      `xml:"count"`
+		Inner   Inner    `xml:"inner,base=16"`
+	}
+
+	xmlData := []byte(`<device id="1F4" flags="1010">
+		<mode>755</mode>
+		<serial>0x1F4</serial>
+		<port>0b1010</port>
+		<port>0o17</port>
+		<port>80</port>
+		<count>010</count>
+		<inner><code>10</code></inner>
+	</device>`)
+
+	var d Device
+	if err := xmlctx.Unmarshal(xmlData, &d); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if d.ID != 500 {
+		t.Errorf("ID: got %d, want 500", d.ID)
+	}
+	if d.Flags != 10 {
+		t.Errorf("Flags: got %d, want 10", d.Flags)
+	}
+	if d.Mode != 0755 {
+		t.Errorf("Mode: got %o, want 755", d.Mode)
+	}
+	if d.Serial == nil || *d.Serial != 500 {
+		t.Errorf("Serial: got %v, want 500", d.Serial)
+	}
+	if !reflect.DeepEqual(d.Ports, []uint16{10, 15, 80}) {
+		t.Errorf("Ports: got %v, want [10 15 80]", d.Ports)
+	}
+	if d.Mask != 0xff {
+		t.Errorf("Mask: got %d, want 255", d.Mask)
+	}
+	// Fields without a base option stay decimal
+	if d.Count != 10 {
+		t.Errorf("Count: got %d, want 10", d.Count)
+	}
+	// The base of a struct field doesn't apply to the fields within it
+	if d.Inner.Code != 10 {
+		t.Errorf("Inner.Code: got %d, want 10", d.Inner.Code)
+	}
+
+	type Invalid struct {
+		XMLName xml.Name `xml:"device"`
+		ID      int      `xml:"id,attr,base=1"`
+	}
+	var invalid Invalid
+	err := xmlctx.Unmarshal([]byte(`<device id="1"/>`), &invalid)
+	if err == nil || !strings.Contains(err.Error(), "invalid base") {
+		t.Errorf("Expected invalid base error, got %v", err)
+	}
+
+	// Fixed bases also accept their prefix, and path fields take the option
+	type Legacy struct {
+		XMLName xml.Name `xml:"device"`
+		ID      int      `xml:"id,attr,base=16"`
+		Mode    uint32   `xml:"mode,base=8"`
+		Flags   int8     `xml:"flags,base=2"`
+		Slot    int      `xml:"bus>slot,base=16"`
+		Port    uint     `xml:"bus>port>@number,base=16"`
+	}
+	var legacy Legacy
+	err = xmlctx.Unmarshal([]byte(`<device id="0x1F4">
+		<mode>0o755</mode>
+		<flags>-0B101</flags>
+		<bus><slot>0XA</slot><port number="1f"/></bus>
+	</device>`), &legacy)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if legacy.ID != 500 {
+		t.Errorf("ID: got %d, want 500", legacy.ID)
+	}
+	if legacy.Mode != 0755 {
+		t.Errorf("Mode: got %o, want 755", legacy.Mode)
+	}
+	if legacy.Flags != -5 {
+		t.Errorf("Flags: got %d, want -5", legacy.Flags)
+	}
+	if legacy.Slot != 10 {
+		t.Errorf("Slot: got %d, want 10", legacy.Slot)
+	}
+	if legacy.Port != 31 {
+		t.Errorf("Port: got %d, want 31", legacy.Port)
+	}
+
+	// Only the prefix of the field's base is accepted
+	legacy = Legacy{}
+	err = xmlctx.Unmarshal([]byte(`<device id="0o17"/>`), &legacy)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse integer") {
+		t.Errorf("Expected integer parse error for another base's prefix, got %v", err)
+	}
+
+	// Chardata fields, and attribute fields falling back to chardata, take
+	// the option too
+	type Register struct {
+		XMLName xml.Name `xml:"register"`
+		Value   int      `xml:",chardata,base=16"`
+	}
+	type Flag struct {
+		XMLName xml.Name `xml:"flag"`
+		Mask    uint8    `xml:"mask,attr,orchardata,base=2"`
+	}
+	register, err := xmlctx.Parse[Register]([]byte(`<register>1F</register>`))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if register.Value != 31 {
+		t.Errorf("Register.Value: got %d, want 31", register.Value)
+	}
+	for _, data := range []string{`<flag>101</flag>`, `<flag mask="101"/>`} {
+		flag, err := xmlctx.Parse[Flag]([]byte(data))
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %s: %v", data, err)
+		}
+		if flag.Mask != 5 {
+			t.Errorf("Flag.Mask from %s: got %d, want 5", data, flag.Mask)
+		}
+	}
+}
+
+// TestDecodeErrorPath tests decode failures returning a DecodeError with the
+// path of the failing element, using the prefixes of the document
+func TestDecodeErrorPath(t *testing.T) {
+	type Metadata struct {
+		Custom int `xml:"meta:custom-field"`
+		Level  int `xml:"level,attr"`
+	}
+	type User struct {
+		XMLName  xml.Name `xml:"user"`
+		Name     string   `xml:"name"`
+		Metadata Metadata `xml:"meta:metadata"`
+		Score    uint     `xml:"stats>score"`
+		Ratio    float64  `xml:"ratio"`
+	}
+	opts := []xmlctx.Option{xmlctx.WithNamespaces(map[string]string{"meta": "http://example.com/meta"})}
+
+	tests := []struct {
+		name    string
+		xml     string
+		path    string
+		message string
+	}{
+		{
+			name:    "element",
+			xml:     `<user xmlns:ns2="http://example.com/meta"><name>Ana</name><ns2:metadata><ns2:custom-field>abc</ns2:custom-field></ns2:metadata></user>`,
+			path:    "user > ns2:metadata > ns2:custom-field",
+			message: "failed to parse integer",
+		},
+		{
+			name:    "attribute",
+			xml:     `<user xmlns:ns2="http://example.com/meta"><ns2:metadata level="high"/></user>`,
+			path:    "user > ns2:metadata",
+			message: "failed to parse integer",
+		},
+		{
+			name:    "path field",
+			xml:     `<user><stats><score>-1</score></stats></user>`,
+			path:    "user > stats > score",
+			message: "failed to parse unsigned integer",
+		},
+		{
+			name:    "float",
+			xml:     `<user><ratio>half</ratio></user>`,
+			path:    "user > ratio",
+			message: "failed to parse float",
+		},
+		{
+			// Declarations on the failing element itself are taken into account
+			name:    "default namespace",
+			xml:     `<user xmlns:ns2="http://example.com/meta"><ns2:metadata><custom-field xmlns="http://example.com/meta">x</custom-field></ns2:metadata></user>`,
+			path:    "user > ns2:metadata > custom-field",
+			message: "failed to parse integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user User
+			err := xmlctx.Unmarshal([]byte(tt.xml), &user, opts...)
+			var decodeErr *xmlctx.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Expected DecodeError, got %v", err)
+			}
+			if decodeErr.Path != tt.path {
+				t.Errorf("Path: got %q, want %q", decodeErr.Path, tt.path)
+			}
+			if !strings.Contains(err.Error(), tt.message) || !strings.HasPrefix(err.Error(), tt.path+": ") {
+				t.Errorf("Error: got %q, want path and %q", err.Error(), tt.message)
+			}
+			var numErr *strconv.NumError
+			if !errors.As(err, &numErr) {
+				t.Errorf("Error should wrap a strconv.NumError, got: %v", err)
+			}
+		})
+	}
+
+	// Slice targets include the root containing their elements
+	var scores []int
+	err := xmlctx.Unmarshal([]byte(`<scores><score>1</score><score>two</score></scores>`), &scores)
+	var decodeErr *xmlctx.DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Path != "scores > score" {
+		t.Errorf("Slice path: got %v, want scores > score", err)
+	}
+}
+
+// TestPathLeafOptions tests path fields honouring the options of their tags
+// like direct fields, and rejecting those that need the enclosing struct
+func TestPathLeafOptions(t *testing.T) {
+	type Product struct {
+		XMLName  xml.Name `xml:"product"`
+		Title    string   `xml:"info>title,token"`
+		Tags     []string `xml:"info>tags,list"`
+		Grade    rune     `xml:"info>grade,char"`
+		Price    float64  `xml:"info>price,scale=scale"`
+		Featured bool     `xml:"info>featured,presence"`
+		Code     int      `xml:"info>code,base=16"`
+		Unit     string   `xml:"info>weight,attr=unit"`
+	}
+
+	xmlData := []byte(`<product>
+		<info>
+			<title>  Blue
+				widget </title>
+			<tags>new sale</tags>
+			<grade>A</grade>
+			<price currency="EUR" scale="2">1999</price>
+			<featured/>
+			<code>1F</code>
+			<weight unit="kg">2</weight>
+		</info>
+	</product>`)
+
+	var p Product
+	if err := xmlctx.Unmarshal(xmlData, &p); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if p.Title != "Blue widget" {
+		t.Errorf("Title: got %q, want %q", p.Title, "Blue widget")
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"new", "sale"}) {
+		t.Errorf("Tags: got %v, want [new sale]", p.Tags)
+	}
+	if p.Grade != 'A' {
+		t.Errorf("Grade: got %q, want 'A'", p.Grade)
+	}
+	if p.Price != 19.99 {
+		t.Errorf("Price: got %v, want 19.99", p.Price)
+	}
+	if !p.Featured {
+		t.Error("Featured: got false, want true")
+	}
+	if p.Code != 31 {
+		t.Errorf("Code: got %d, want 31", p.Code)
+	}
+	if p.Unit != "kg" {
+		t.Errorf("Unit: got %s, want kg", p.Unit)
+	}
+
+	// Duplicates are reported for path fields too
+	type Contact struct {
+		XMLName xml.Name `xml:"contact"`
+		Email   string   `xml:"details>email"`
+	}
+	var c Contact
+	err := xmlctx.Unmarshal([]byte(`<contact><details><email>a@example.com</email><email>b@example.com</email></details></contact>`), &c, xmlctx.WithDisallowDuplicates())
+	if err == nil || !strings.Contains(err.Error(), "second occurrence of <email>") {
+		t.Errorf("Expected duplicate error, got %v", err)
+	}
+
+	// Options that depend on the enclosing struct fail loudly
+	type Defaulted struct {
+		XMLName xml.Name `xml:"settings"`
+		Theme   string   `xml:"ui>theme,default=light"`
+	}
+	var d Defaulted
+	err = xmlctx.Unmarshal([]byte(`<settings/>`), &d)
+	if err == nil || !strings.Contains(err.Error(), "option default is not supported") {
+		t.Errorf("Expected unsupported option error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// Reserved keys of the element maps produced by DecodeGeneric
+const (
+	// GenericAttrsKey holds an element's attributes, as a map[string]any of
+	// attribute names to string values
+	GenericAttrsKey = "#attrs"
+	// GenericTextKey holds an element's trimmed text, as a string
+	GenericTextKey = "#text"
+)
+
+// DecodeGeneric decodes the next document into a generic tree, independent of
+// any struct, for diffing or transforming documents semantically. The result
+// maps the root element's name to its element map. Each element map holds:
+//
+//   - GenericAttrsKey: the attributes, if any, excluding namespace declarations
+//   - GenericTextKey: the text directly inside the element, trimmed, if not empty
+//   - for each child element name, a []any of the child element maps in
+//     document order, even when the child occurs once
+//
+// Names are qualified with their prefix from the namespace map (e.g.,
+// "ns1:bio"), whatever prefix the document used. Elements in the default
+// namespace, or in no namespace, and attributes in no namespace use their
+// local name alone; names in namespaces missing from the map use Clark
+// notation (e.g., "{http://example.com/other}id"). Comments and processing
+// instructions are dropped. DecodeGeneric returns io.EOF if the input has no
+// further element.
+func (d *Decoder) DecodeGeneric() (map[string]any, error) {
+	names := newGenericNames(d.namespaces)
+	for {
+		tok, err := d.rootToken()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			elem, err := d.decodeGenericElement(names, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{names.element(start.Name): elem}, nil
+		}
+	}
+}
+
+// decodeGenericElement decodes the element just opened into its element map
+func (d *Decoder) decodeGenericElement(names genericNames, start xml.StartElement) (map[string]any, error) {
+	elem := make(map[string]any)
+	attrs := make(map[string]any)
+	for _, attr := range start.Attr {
+		if isNamespaceDeclaration(attr) {
+			continue
+		}
+		attrs[names.attribute(attr.Name)] = attr.Value
+	}
+	if len(attrs) > 0 {
+		elem[GenericAttrsKey] = attrs
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := d.decoder.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := d.decodeGenericElement(names, t)
+			if err != nil {
+				return nil, err
+			}
+			name := names.element(t.Name)
+			children, _ := elem[name].([]any)
+			elem[name] = append(children, child)
+		case xml.CharData:
+			text.Write(t)
+			if err := d.checkTextLength(text.Len()); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if s := strings.TrimSpace(text.String()); s != "" {
+				elem[GenericTextKey] = s
+			}
+			return elem, nil
+		}
+	}
+}
+
+// genericNames qualifies names for DecodeGeneric using the namespace map
+type genericNames struct {
+	defaultNS string
+	prefixes  map[string]string // namespace URI to prefix
+}
+
+// newGenericNames indexes the namespace map by URI, preferring the
+// alphabetically first prefix when several map to one namespace
+func newGenericNames(namespaces map[string]string) genericNames {
+	names := genericNames{defaultNS: namespaces[""], prefixes: make(map[string]string)}
+	for prefix, uri := range namespaces {
+		if prefix == "" {
+			continue
+		}
+		if current, ok := names.prefixes[uri]; !ok || prefix < current {
+			names.prefixes[uri] = prefix
+		}
+	}
+	return names
+}
+
+// element returns the qualified name of an element
+func (n genericNames) element(name xml.Name) string {
+	if name.Space == "" || name.Space == n.defaultNS {
+		return name.Local
+	}
+	return n.qualified(name)
+}
+
+// attribute returns the qualified name of an attribute, which is only
+// unprefixed when in no namespace
+func (n genericNames) attribute(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return n.qualified(name)
+}
+
+// qualified returns name with its mapped prefix, or in Clark notation
+func (n genericNames) qualified(name xml.Name) string {
+	if name.Space == xmlNamespaceURI {
+		return "xml:" + name.Local
+	}
+	if prefix, ok := n.prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
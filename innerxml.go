@@ -0,0 +1,182 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// xmlNamespaceURI is the namespace bound to the reserved "xml" prefix
+const xmlNamespaceURI = "http://www.w3.org/XML/1998/namespace"
+
+// writeFragment writes the captured tokens of one element (from captureSubtree)
+// as self-contained XML. Every namespace used in the fragment is declared on
+// its top element, with prefixes taken from the decoder's namespace map where
+// possible, so the fragment can be parsed again on its own.
+func (d *Decoder) writeFragment(b *strings.Builder, tokens []xml.Token) {
+	prefixes := d.fragmentPrefixes(tokens)
+
+	for i, tok := range tokens {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			b.WriteByte('<')
+			writeQualifiedName(b, prefixes, t.Name)
+			if i == 0 {
+				writeNamespaceDeclarations(b, prefixes)
+			}
+			for _, attr := range t.Attr {
+				// Source declarations are replaced by those written above
+				if isNamespaceDeclaration(attr) {
+					continue
+				}
+				b.WriteByte(' ')
+				writeQualifiedName(b, prefixes, attr.Name)
+				b.WriteString(`="`)
+				b.WriteString(attrEscaper.Replace(attr.Value))
+				b.WriteByte('"')
+			}
+			b.WriteByte('>')
+		case xml.EndElement:
+			b.WriteString("</")
+			writeQualifiedName(b, prefixes, t.Name)
+			b.WriteByte('>')
+		default:
+			writeMiscToken(b, tok)
+		}
+	}
+}
+
+// fragmentPrefixes assigns a prefix to each namespace used in the fragment. The
+// default namespace keeps the empty prefix when the fragment has no unqualified
+// elements and no attributes in it; other namespaces use their prefix from the
+// namespace map, or a generated one (ns1, ns2, ...) when they have none.
+func (d *Decoder) fragmentPrefixes(tokens []xml.Token) map[string]string {
+	var uris []string
+	seen := make(map[string]bool)
+	attrURIs := make(map[string]bool)
+	unqualified := false
+	use := func(uri string) {
+		if uri != "" && uri != xmlNamespaceURI && !seen[uri] {
+			seen[uri] = true
+			uris = append(uris, uri)
+		}
+	}
+	for _, tok := range tokens {
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		use(start.Name.Space)
+		if start.Name.Space == "" {
+			unqualified = true
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Space == "xmlns" || attr.Name.Space == "" {
+				continue
+			}
+			use(attr.Name.Space)
+			attrURIs[attr.Name.Space] = true
+		}
+	}
+
+	// Prefer the alphabetically first prefix when several map to a namespace
+	mapped := make(map[string]string)
+	for prefix, uri := range d.namespaces {
+		if prefix == "" {
+			continue
+		}
+		if current, ok := mapped[uri]; !ok || prefix < current {
+			mapped[uri] = prefix
+		}
+	}
+
+	prefixes := map[string]string{xmlNamespaceURI: "xml"}
+	taken := make(map[string]bool)
+	generated := 0
+	for _, uri := range uris {
+		if prefix, ok := mapped[uri]; ok {
+			prefixes[uri] = prefix
+			taken[prefix] = true
+			continue
+		}
+		if uri == d.namespaces[""] && !unqualified && !attrURIs[uri] {
+			prefixes[uri] = ""
+			continue
+		}
+		for {
+			generated++
+			prefix := fmt.Sprintf("ns%d", generated)
+			if _, inMap := d.namespaces[prefix]; !inMap && !taken[prefix] {
+				prefixes[uri] = prefix
+				taken[prefix] = true
+				break
+			}
+		}
+	}
+	return prefixes
+}
+
+// writeNamespaceDeclarations writes xmlns attributes for the assigned prefixes
+func writeNamespaceDeclarations(b *strings.Builder, prefixes map[string]string) {
+	uris := make([]string, 0, len(prefixes))
+	for uri := range prefixes {
+		if uri != xmlNamespaceURI {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Slice(uris, func(i, j int) bool { return prefixes[uris[i]] < prefixes[uris[j]] })
+
+	for _, uri := range uris {
+		b.WriteString(" xmlns")
+		if prefix := prefixes[uri]; prefix != "" {
+			b.WriteByte(':')
+			b.WriteString(prefix)
+		}
+		b.WriteString(`="`)
+		b.WriteString(attrEscaper.Replace(uri))
+		b.WriteByte('"')
+	}
+}
+
+// writeQualifiedName writes name with the prefix assigned to its namespace
+func writeQualifiedName(b *strings.Builder, prefixes map[string]string, name xml.Name) {
+	if prefix := prefixes[name.Space]; name.Space != "" && prefix != "" {
+		b.WriteString(prefix)
+		b.WriteByte(':')
+	}
+	b.WriteString(name.Local)
+}
+
+// writeMiscToken writes character data, comments, processing instructions,
+// and directives as XML
+func writeMiscToken(b *strings.Builder, tok xml.Token) {
+	switch t := tok.(type) {
+	case xml.CharData:
+		b.WriteString(textEscaper.Replace(string(t)))
+	case xml.Comment:
+		b.WriteString("<!--")
+		b.Write(t)
+		b.WriteString("-->")
+	case xml.ProcInst:
+		b.WriteString("<?")
+		b.WriteString(t.Target)
+		if len(t.Inst) > 0 {
+			b.WriteByte(' ')
+			b.Write(t.Inst)
+		}
+		b.WriteString("?>")
+	case xml.Directive:
+		b.WriteString("<!")
+		b.Write(t)
+		b.WriteString(">")
+	}
+}
+
+// textEscaper escapes character data, keeping line breaks readable
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+// attrEscaper escapes attribute values, including the whitespace that
+// attribute value normalization would otherwise replace
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;",
+	"\r", "&#xD;", "\n", "&#xA;", "\t", "&#x9;")
@@ -0,0 +1,64 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"maps"
+)
+
+// Sources of namespace mappings reported by NamespaceSources
+const (
+	// NamespaceConfigured marks a mapping set by options such as WithNamespaces
+	NamespaceConfigured = "configured"
+	// NamespaceFromDocument marks a mapping seeded from the root element's
+	// declarations, see WithNamespacesFromDocument
+	NamespaceFromDocument = "document"
+)
+
+// seedNamespaces adds the namespace declarations on the root element to the
+// namespace map for prefixes the options left unmapped, replacing those
+// seeded from an earlier document. The configured map is never modified.
+func (d *Decoder) seedNamespaces(attrs []xml.Attr) {
+	if d.documentPrefixes != nil {
+		d.namespaces = d.configuredNamespaces
+		d.documentPrefixes = nil
+	}
+	for _, attr := range attrs {
+		if !isNamespaceDeclaration(attr) {
+			continue
+		}
+		prefix := ""
+		if attr.Name.Space == "xmlns" {
+			prefix = attr.Name.Local
+		}
+		if _, ok := d.namespaces[prefix]; ok {
+			continue
+		}
+		if d.documentPrefixes == nil {
+			d.configuredNamespaces = d.namespaces
+			d.namespaces = maps.Clone(d.namespaces)
+			if d.namespaces == nil {
+				d.namespaces = make(map[string]string)
+			}
+			d.documentPrefixes = make(map[string]bool)
+		}
+		d.namespaces[prefix] = attr.Value
+		d.documentPrefixes[prefix] = true
+	}
+}
+
+// NamespaceSources reports where each mapping of the namespace map in use
+// came from, keyed by prefix: NamespaceConfigured for mappings set by
+// options, and NamespaceFromDocument for those seeded from the last decoded
+// root element under WithNamespacesFromDocument. It helps debug namespace
+// confusion when both are combined.
+func (d *Decoder) NamespaceSources() map[string]string {
+	sources := make(map[string]string, len(d.namespaces))
+	for prefix := range d.namespaces {
+		if d.documentPrefixes[prefix] {
+			sources[prefix] = NamespaceFromDocument
+		} else {
+			sources[prefix] = NamespaceConfigured
+		}
+	}
+	return sources
+}
@@ -0,0 +1,291 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// pathNode is a node in the trie of path field segments of a struct type.
+// Fields sharing a path prefix (e.g., "a>b>c" and "a>b>d") share the nodes
+// for "a" and "b", so the shared wrapper elements are traversed once.
+type pathNode struct {
+	segment  string // tag segment matched against an element, e.g. "ram:ID"
+	path     string // full path from the struct, e.g. "a>b>ram:ID"
+	parent   *pathNode
+	fields   []fieldInfo // struct fields whose path ends at this node
+	attrs    []pathAttr
+	children []*pathNode
+	err      error // set on the root when a path field carries an unsupported option
+}
+
+// unsupportedPathOptions are the tag options that depend on the state of the
+// struct holding a field, which path fields are not decoded with
+var unsupportedPathOptions = []string{"dedup", "default"}
+
+// pathAttr is a path field ending in an attribute of a path node, like the
+// "@unit" in "details>quantity>@unit"
+type pathAttr struct {
+	name string    // attribute tag, e.g. "unit" or "ns1:unit"
+	info fieldInfo // the struct field
+}
+
+// child returns the child node for segment, creating it if needed
+func (n *pathNode) child(segment string) *pathNode {
+	for _, c := range n.children {
+		if c.segment == segment {
+			return c
+		}
+	}
+	path := segment
+	if n.path != "" {
+		path = n.path + ">" + segment
+	}
+	c := &pathNode{segment: segment, path: path, parent: n}
+	n.children = append(n.children, c)
+	return c
+}
+
+// leafPaths returns the full paths of the fields at or below this node
+func (n *pathNode) leafPaths() []string {
+	var paths []string
+	if len(n.fields) > 0 {
+		paths = append(paths, n.path)
+	}
+	for _, a := range n.attrs {
+		paths = append(paths, n.path+">@"+a.name)
+	}
+	for _, c := range n.children {
+		paths = append(paths, c.leafPaths()...)
+	}
+	return paths
+}
+
+// pathTries caches the path trie of each struct type
+var pathTries sync.Map // map[reflect.Type]*pathNode
+
+// pathTrieFor returns the root of the path trie for the struct type t
+func pathTrieFor(t reflect.Type) *pathNode {
+	if root, ok := pathTries.Load(t); ok {
+		return root.(*pathNode)
+	}
+	root, _ := pathTries.LoadOrStore(t, buildPathTrie(t))
+	return root.(*pathNode)
+}
+
+// buildPathTrie builds the trie of all path fields in the struct type t
+func buildPathTrie(t reflect.Type) *pathNode {
+	root := &pathNode{}
+	for _, info := range structFields(t) {
+		// Only element fields with path syntax (e.g., "a>b>c") belong in the trie
+		if !info.isElement() || !info.tag.isPath() {
+			continue
+		}
+		for _, option := range unsupportedPathOptions {
+			if _, ok := info.tag.value(option); ok && root.err == nil {
+				root.err = fmt.Errorf("path field %s: option %s is not supported on path tags", info.name, option)
+			}
+		}
+
+		segments := strings.Split(info.tag.name, ">")
+		attrName, isAttr := strings.CutPrefix(segments[len(segments)-1], "@")
+		if isAttr {
+			segments = segments[:len(segments)-1]
+		}
+
+		node := root
+		for _, segment := range segments {
+			node = node.child(segment)
+		}
+		if isAttr {
+			// Attribute of the last element on the path (e.g., "a>b>@unit")
+			node.attrs = append(node.attrs, pathAttr{name: attrName, info: info})
+			continue
+		}
+		node.fields = append(node.fields, info)
+	}
+	return root
+}
+
+// matchPathNodes returns the children of the given nodes whose segment matches the element
+func (d *Decoder) matchPathNodes(nodes []*pathNode, start xml.StartElement) []*pathNode {
+	var matches []*pathNode
+	for _, n := range nodes {
+		for _, c := range n.children {
+			if d.matchesField(c.segment, start.Name.Local, start.Name.Space) {
+				matches = append(matches, c)
+			}
+		}
+	}
+	return matches
+}
+
+// decodePathNodes decodes the path fields below the given nodes, which all
+// matched the element just opened, from the children of that element
+func (d *Decoder) decodePathNodes(decoder *xml.Decoder, v reflect.Value, nodes []*pathNode) error {
+	// Candidate child nodes, and whether each has been decoded in this element
+	var candidates []*pathNode
+	for _, n := range nodes {
+		candidates = append(candidates, n.children...)
+	}
+	found := make([]bool, len(candidates))
+	// Track text in the parent element to report untraversable paths in strict mode
+	hasText := false
+
+	// Navigate through the parent element
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			// Find the candidates matching this element. Fields and attributes
+			// ending at a node take their first element, except slice fields,
+			// which append every element; nodes with children are descended
+			// into on every occurrence, so paths below repeated wrappers are
+			// found whichever occurrence holds them.
+			var leaf *pathNode
+			var inner []*pathNode
+			var matched []int
+			for i, c := range candidates {
+				if !d.matchesField(c.segment, t.Name.Local, t.Name.Space) {
+					continue
+				}
+				if len(c.children) > 0 {
+					inner = append(inner, c)
+				}
+				if found[i] && !d.collectsPathElements(v, c) {
+					if len(c.fields) > 0 && d.disallowDuplicates && !d.firstWins {
+						return fmt.Errorf("duplicate element: second occurrence of <%s> for field %s", t.Name.Local, c.fields[0].name)
+					}
+					continue
+				}
+				if len(c.fields) > 0 && leaf == nil {
+					leaf = c
+				}
+				if found[i] {
+					continue
+				}
+				matched = append(matched, i)
+				if err := d.decodePathAttrs(v, c, t); err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case leaf != nil && len(inner) > 0:
+				// A path ending here (e.g., "a>b") and paths continuing below it
+				// (e.g., "a>b>c") both receive the element
+				decodeWhole := func(replay *xml.Decoder) error {
+					return d.decodePathLeaf(replay, v, leaf, t)
+				}
+				if err := d.decodeSharedElement(decoder, v, t, decodeWhole, inner); err != nil {
+					return err
+				}
+			case leaf != nil:
+				// This is the final segment - decode into the field
+				if err := d.decodePathLeaf(decoder, v, leaf, t); err != nil {
+					return err
+				}
+			case len(inner) > 0:
+				// More segments remaining - descend into the element
+				d.enterElement(t)
+				if err := d.leaveElement(d.decodePathNodes(decoder, v, inner)); err != nil {
+					return err
+				}
+			default:
+				// No fields matched this element - skip it
+				d.recordUnmatched(t.Name)
+				if err := decoder.Skip(); err != nil {
+					return err
+				}
+			}
+			for _, i := range matched {
+				found[i] = true
+			}
+
+		case xml.CharData:
+			if len(strings.TrimSpace(string(t))) > 0 {
+				hasText = true
+			}
+
+		case xml.EndElement:
+			// Reached end of parent element
+			if d.strict && hasText {
+				for i, c := range candidates {
+					if !found[i] {
+						return fmt.Errorf("cannot traverse path %q: <%s> has text content but no <%s> child", c.path, c.parent.segment, c.segment)
+					}
+				}
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// collectsPathElements reports whether the field ending at the node is a slice
+// that collects every matching element rather than only the first
+func (d *Decoder) collectsPathElements(v reflect.Value, node *pathNode) bool {
+	return len(node.fields) > 0 && d.collectsElements(v.Field(node.fields[0].index))
+}
+
+// decodePathLeaf decodes the element matched by the last segment of a path
+// into the fields ending at the node, like a direct field, so options such as
+// token or scale apply. Fields sharing the path each decode a replay of it.
+func (d *Decoder) decodePathLeaf(decoder *xml.Decoder, v reflect.Value, leaf *pathNode, start xml.StartElement) error {
+	if len(leaf.fields) == 1 {
+		info := leaf.fields[0]
+		return d.decodeField(decoder, v.Field(info.index), info, start)
+	}
+	tokens, err := d.captureSubtree(decoder, start)
+	if err != nil {
+		return err
+	}
+	for _, info := range leaf.fields {
+		replay := newReplayDecoder(tokens)
+		// Consume the replayed start element
+		if _, err := replay.Token(); err != nil {
+			return err
+		}
+		if err := d.decodeField(replay, v.Field(info.index), info, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodePathAttrs sets the path fields ending in an attribute of the node
+// (e.g., "a>b>@unit") from the attributes of the element it matched
+func (d *Decoder) decodePathAttrs(v reflect.Value, node *pathNode, start xml.StartElement) error {
+	for _, pa := range node.attrs {
+		for _, attr := range start.Attr {
+			if !d.matchesAttribute(pa.name, attr) {
+				continue
+			}
+			restore, err := d.useIntBase(pa.info)
+			if err != nil {
+				return err
+			}
+			err = d.setFieldValue(v.Field(pa.info.index), attr.Value)
+			restore()
+			if err != nil {
+				return withField(err, pa.info.name)
+			}
+			if err := d.callFieldHook(pa.info.name, v.Field(pa.info.index)); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package xmlctx
+
+import (
+	"strings"
+	"sync"
+)
+
+// Pool reuses decoders sharing one configuration, set when the pool is
+// created, for services decoding the same kind of document at high rates.
+// Each decoder is Reset between uses, so no state carries over from one
+// document to the next. A Pool is safe for concurrent use.
+type Pool struct {
+	config   *Config
+	decoders sync.Pool
+}
+
+// NewPool applies opts once to create a pool of decoders
+func NewPool(opts ...Option) *Pool {
+	return &Pool{config: NewConfig(opts...)}
+}
+
+// Unmarshal decodes data into v with a pooled decoder, like the package-level
+// Unmarshal
+func (p *Pool) Unmarshal(data []byte, v any) error {
+	r := strings.NewReader(string(data))
+	d, ok := p.decoders.Get().(*Decoder)
+	if ok {
+		d.Reset(r)
+	} else {
+		d = p.config.NewDecoder(r)
+	}
+	err := d.Decode(v)
+	p.decoders.Put(d)
+	return err
+}
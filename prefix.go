@@ -0,0 +1,90 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// declaresNamespaces reports whether attrs hold any namespace declaration
+func declaresNamespaces(attrs []xml.Attr) bool {
+	return slices.ContainsFunc(attrs, isNamespaceDeclaration)
+}
+
+// documentPrefix returns the prefix the document most likely used for an
+// element in namespace uri, found by searching the namespace declarations in
+// scope from the innermost out. xml.Decoder discards prefixes, so this is
+// best-effort: it returns "" for the default namespace and when no
+// declaration binds uri, and the first prefix declared when an element binds
+// several prefixes to uri.
+func (d *Decoder) documentPrefix(uri string) string {
+	return scopePrefix(d.scopes, uri)
+}
+
+// scopePrefix returns the prefix bound to uri by the namespace declarations
+// in scopes, innermost last, as described for documentPrefix
+func scopePrefix(scopes [][]xml.Attr, uri string) string {
+	if uri == "" {
+		return ""
+	}
+	if uri == xmlNamespaceURI {
+		return "xml"
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		for _, attr := range scopes[i] {
+			if !isNamespaceDeclaration(attr) || attr.Value != uri {
+				continue
+			}
+			prefix := attr.Name.Local
+			if attr.Name.Space == "" {
+				prefix = "" // xmlns="uri"
+			}
+			if !rebound(scopes, prefix, i) {
+				return prefix
+			}
+		}
+	}
+	return ""
+}
+
+// rebound reports whether prefix is declared again in a scope inside scope i,
+// hiding its declaration there
+func rebound(scopes [][]xml.Attr, prefix string, i int) bool {
+	for _, attrs := range scopes[i+1:] {
+		for _, attr := range attrs {
+			if !isNamespaceDeclaration(attr) {
+				continue
+			}
+			if (prefix == "" && attr.Name.Space == "") || (prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setPrefixField sets the struct's ,prefix field, if any, to the prefix the
+// document used for the element
+func (d *Decoder) setPrefixField(v reflect.Value, start xml.StartElement) {
+	field := d.findOptionField(v, "prefix")
+	if field.IsValid() && field.Kind() == reflect.String {
+		field.SetString(d.documentPrefix(start.Name.Space))
+	}
+}
+
+// formatPath formats the path of the elements being decoded for a
+// DecodeError, giving each element the prefix the document most likely used
+// for it, as documentPrefix does
+func (d *Decoder) formatPath() string {
+	scopes := make([][]xml.Attr, len(d.path))
+	names := make([]string, len(d.path))
+	for i, start := range d.path {
+		scopes[i] = start.Attr
+		names[i] = start.Name.Local
+		if prefix := scopePrefix(scopes[:i+1], start.Name.Space); prefix != "" {
+			names[i] = prefix + ":" + start.Name.Local
+		}
+	}
+	return strings.Join(names, " > ")
+}
@@ -0,0 +1,157 @@
+package xmlctx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Schema is a lightweight description of a document's structure, checked
+// while decoding when set with WithSchema. It covers the common needs of full
+// XSD validation: required children, cardinalities, and allowed namespaces.
+type Schema struct {
+	// Elements maps element tags (e.g., "invoice" or "ns1:line"), resolved
+	// through the decoder's namespace map like struct tags, to the rules for
+	// their children. Only elements decoded into structs are checked. When
+	// several tags match an element, the first in sorted order applies.
+	Elements map[string]ElementSchema
+	// Namespaces lists the namespace URIs elements may use, with "" allowing
+	// unqualified elements. An empty list allows any namespace.
+	Namespaces []string
+}
+
+// ElementSchema lists the children expected in an element
+type ElementSchema struct {
+	Children []ChildSchema
+}
+
+// ChildSchema constrains the occurrences of a child element
+type ChildSchema struct {
+	// Name is the child's tag (e.g., "line" or "ns1:line")
+	Name string
+	// Min is the minimum number of occurrences; 1 makes the child required
+	Min int
+	// Max is the maximum number of occurrences; zero means unbounded
+	Max int
+}
+
+// SchemaViolation describes a single way a document breaks its Schema
+type SchemaViolation struct {
+	// Element is the element whose content broke the rule, as {namespace}local
+	Element string
+	// Child is the schema name of the offending child, or the element name for
+	// namespace violations
+	Child string
+	// Count is the number of occurrences of the child found
+	Count int
+	// Message describes the violation
+	Message string
+}
+
+// SchemaError is returned by Decode when the document decoded successfully
+// but broke its Schema. It lists every violation found.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+// Error implements the error interface
+func (e *SchemaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "schema violations: " + strings.Join(messages, "; ")
+}
+
+// WithSchema validates the document against schema while decoding. Decode
+// returns a *SchemaError listing the violations once the document has been
+// decoded, so the decoded value can still be inspected.
+func WithSchema(schema *Schema) Option {
+	return func(d *Decoder) {
+		d.schema = schema
+		d.schemaTags = nil
+		if schema != nil {
+			d.schemaTags = slices.Sorted(maps.Keys(schema.Elements))
+		}
+	}
+}
+
+// schemaCounts tracks the occurrences of the children of one element
+type schemaCounts struct {
+	rules  *ElementSchema
+	counts []int
+}
+
+// startSchemaCounts returns the tracker for an element's children, or nil
+// when no schema rules apply to it
+func (d *Decoder) startSchemaCounts(start xml.StartElement) *schemaCounts {
+	if d.schema == nil {
+		return nil
+	}
+	for _, name := range d.schemaTags {
+		if d.matchesField(name, start.Name.Local, start.Name.Space) {
+			rules := d.schema.Elements[name]
+			return &schemaCounts{rules: &rules, counts: make([]int, len(rules.Children))}
+		}
+	}
+	return &schemaCounts{}
+}
+
+// checkSchemaChild counts a child element of parent and checks its namespace
+func (d *Decoder) checkSchemaChild(c *schemaCounts, parent, child xml.StartElement) {
+	if c == nil {
+		return
+	}
+	d.checkSchemaNamespace(parent.Name, child.Name)
+	if c.rules == nil {
+		return
+	}
+	for i, rule := range c.rules.Children {
+		if d.matchesField(rule.Name, child.Name.Local, child.Name.Space) {
+			c.counts[i]++
+		}
+	}
+}
+
+// checkSchemaNamespace records a violation if the element's namespace is not allowed
+func (d *Decoder) checkSchemaNamespace(parent, name xml.Name) {
+	if d.schema == nil || len(d.schema.Namespaces) == 0 || slices.Contains(d.schema.Namespaces, name.Space) {
+		return
+	}
+	d.violations = append(d.violations, SchemaViolation{
+		Element: formatName(parent),
+		Child:   formatName(name),
+		Count:   1,
+		Message: fmt.Sprintf("element %s: namespace %q is not allowed", formatName(name), name.Space),
+	})
+}
+
+// endSchemaCounts checks the cardinalities of the element's children once it ends
+func (d *Decoder) endSchemaCounts(c *schemaCounts, start xml.StartElement) {
+	if c == nil || c.rules == nil {
+		return
+	}
+	element := formatName(start.Name)
+	for i, rule := range c.rules.Children {
+		count := c.counts[i]
+		var message string
+		switch {
+		case count < rule.Min && count == 0:
+			message = fmt.Sprintf("element %s: missing required child %s", element, rule.Name)
+		case count < rule.Min:
+			message = fmt.Sprintf("element %s: child %s occurs %d times, want at least %d", element, rule.Name, count, rule.Min)
+		case rule.Max > 0 && count > rule.Max:
+			message = fmt.Sprintf("element %s: child %s occurs %d times, want at most %d", element, rule.Name, count, rule.Max)
+		default:
+			continue
+		}
+		d.violations = append(d.violations, SchemaViolation{
+			Element: element,
+			Child:   rule.Name,
+			Count:   count,
+			Message: message,
+		})
+	}
+}
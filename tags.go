@@ -0,0 +1,164 @@
+package xmlctx
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// tagInfo is a parsed xml struct tag, such as `xml:"ns1:profile,omitempty"`
+type tagInfo struct {
+	raw     string            // the full tag as written
+	name    string            // name before the first comma, e.g. "ns1:profile" or "a>b"
+	ns      string            // namespace prefix of the name, e.g. "ns1"
+	local   string            // local part of the name, e.g. "profile"
+	options map[string]bool   // flag options, e.g. "attr", "chardata", "omitempty"
+	values  map[string]string // key=value options, e.g. "cap=count" or "attr=id"
+}
+
+// parseTag parses an xml struct tag into its name and options
+func parseTag(tag string) tagInfo {
+	parts := strings.Split(tag, ",")
+	info := tagInfo{raw: tag, name: parts[0]}
+	info.ns, info.local = splitPrefix(info.name)
+	for _, part := range parts[1:] {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			if info.values == nil {
+				info.values = make(map[string]string)
+			}
+			info.values[key] = value
+			continue
+		}
+		if part == "" {
+			continue
+		}
+		if info.options == nil {
+			info.options = make(map[string]bool)
+		}
+		info.options[part] = true
+	}
+	return info
+}
+
+// splitPrefix splits a name like "ns1:profile" into its prefix and local part.
+// Names in Clark notation (e.g., "{http://example.com/ns}id") and names with
+// escaped colons (e.g., `ext\:code`) have no prefix.
+func splitPrefix(name string) (prefix, local string) {
+	if _, local, ok := splitClark(name); ok {
+		return "", local
+	}
+	if literal, ok := unescapeColons(name); ok {
+		return "", literal
+	}
+	if prefix, local, ok := strings.Cut(name, ":"); ok {
+		return prefix, local
+	}
+	return "", name
+}
+
+// splitClark splits a name in Clark notation, like "{http://example.com/ns}id",
+// into its namespace URI and local part
+func splitClark(name string) (uri, local string, ok bool) {
+	if !strings.HasPrefix(name, "{") {
+		return "", "", false
+	}
+	return strings.Cut(name[1:], "}")
+}
+
+// escapedColon is a colon that belongs to the name itself rather than
+// separating a namespace prefix, e.g. `ext\:code` names "ext:code"
+const escapedColon = `\:`
+
+// unescapeColons returns name with its escaped colons unescaped, reporting
+// whether it had any
+func unescapeColons(name string) (string, bool) {
+	if !strings.Contains(name, escapedColon) {
+		return "", false
+	}
+	return strings.ReplaceAll(name, escapedColon, ":"), true
+}
+
+// has reports whether the tag carries the flag option
+func (t tagInfo) has(option string) bool {
+	return t.options[option]
+}
+
+// value returns the value of a key=value option
+func (t tagInfo) value(key string) (string, bool) {
+	v, ok := t.values[key]
+	return v, ok
+}
+
+// isAttr reports whether the tag maps the field to an attribute of the element
+func (t tagInfo) isAttr() bool {
+	return t.has("attr") && !t.has("any")
+}
+
+// isAnyAttr reports whether the tag collects unmatched attributes (",any,attr")
+func (t tagInfo) isAnyAttr() bool {
+	return t.has("attr") && t.has("any")
+}
+
+// specialTagOptions mark fields that are not matched against child elements by name
+var specialTagOptions = []string{"attr", "chardata", "cdata", "innerxml", "comment", "any", "text", "index", "xmlns", "attr-prefix", "prefix", "count"}
+
+// isSpecial reports whether the tag marks a special field rather than a child element
+func (t tagInfo) isSpecial() bool {
+	for _, option := range specialTagOptions {
+		if t.has(option) {
+			return true
+		}
+	}
+	_, counts := t.value("count")
+	return counts
+}
+
+// isPath reports whether the tag uses path syntax (e.g., "a>b>c")
+func (t tagInfo) isPath() bool {
+	return strings.Contains(t.name, ">")
+}
+
+// fieldInfo describes a struct field carrying an xml tag
+type fieldInfo struct {
+	index int          // index of the field in the struct
+	name  string       // Go field name
+	typ   reflect.Type // Go field type
+	tag   tagInfo      // parsed xml tag; an empty name is replaced by the field name
+	named bool         // whether the tag names the field, rather than the Go field name
+}
+
+// isElement reports whether the field is matched against child elements by name
+func (f fieldInfo) isElement() bool {
+	return !f.tag.isSpecial() && !strings.HasPrefix(f.tag.name, "xmlns")
+}
+
+// structFieldsCache caches the tagged fields of each struct type
+var structFieldsCache sync.Map // map[reflect.Type][]fieldInfo
+
+// structFields returns the fields of the struct type t that carry an xml tag,
+// skipping fields tagged "-". Unnamed tags (e.g., ",omitempty" or ",attr")
+// use the Go field name, like encoding/xml.
+func structFields(t reflect.Type) []fieldInfo {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]fieldInfo)
+	}
+
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("xml")
+		if !ok || tag == "-" {
+			continue
+		}
+		info := parseTag(tag)
+		named := info.name != ""
+		if !named {
+			info.name = field.Name
+			info.local = field.Name
+		}
+		fields = append(fields, fieldInfo{index: i, name: field.Name, typ: field.Type, tag: info, named: named})
+	}
+
+	cached, _ := structFieldsCache.LoadOrStore(t, fields)
+	return cached.([]fieldInfo)
+}